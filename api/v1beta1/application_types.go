@@ -38,6 +38,9 @@ type Descriptor struct {
 	// Description is a brief string description of the Application.
 	Description string `json:"description,omitempty"`
 
+	// DisplayName is an optional human friendly name of the Application.
+	DisplayName string `json:"displayName,omitempty"`
+
 	// Icons is an optional list of icons for an application. Icon information includes the source, size,
 	// and mime type.
 	Icons []ImageSpec `json:"icons,omitempty"`
@@ -60,7 +60,7 @@ func (r *ApplicationReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error)
 	}
 
 	resources, errs := r.updateComponents(ctx, &app)
-	newApplicationStatus := r.getNewApplicationStatus(ctx, &app, resources, &errs)
+	newApplicationStatus := getNewApplicationStatus(ctx, &app, resources, &errs)
 
 	newApplicationStatus.ObservedGeneration = app.Generation
 	if equality.Semantic.DeepEqual(newApplicationStatus, &app.Status) {
@@ -85,8 +85,8 @@ func (r *ApplicationReconciler) updateComponents(ctx context.Context, app *appv1
 	return resources, errs
 }
 
-func (r *ApplicationReconciler) getNewApplicationStatus(ctx context.Context, app *appv1beta1.Application, resources []*unstructured.Unstructured, errList *[]error) *appv1beta1.ApplicationStatus {
-	objectStatuses := r.objectStatuses(ctx, resources, errList)
+func getNewApplicationStatus(ctx context.Context, app *appv1beta1.Application, resources []*unstructured.Unstructured, errList *[]error) *appv1beta1.ApplicationStatus {
+	objectStatuses := objectStatuses(ctx, resources, errList)
 	errs := utilerrors.NewAggregate(*errList)
 
 	aggReady, countReady := aggregateReady(objectStatuses)
@@ -178,7 +178,7 @@ func (r *ApplicationReconciler) setOwnerRefForResources(ctx context.Context, own
 	return nil
 }
 
-func (r *ApplicationReconciler) objectStatuses(ctx context.Context, resources []*unstructured.Unstructured, errs *[]error) []appv1beta1.ObjectStatus {
+func objectStatuses(ctx context.Context, resources []*unstructured.Unstructured, errs *[]error) []appv1beta1.ObjectStatus {
 	logger := getLoggerOrDie(ctx)
 	var objectStatuses []appv1beta1.ObjectStatus
 	for _, resource := range resources {
@@ -0,0 +1,45 @@
+// Copyright 2020 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	appv1beta1 "sigs.k8s.io/application/api/v1beta1"
+)
+
+// ComputeStatus returns the status the Application should have given the pods
+// its selector matches: one component per pod, ComponentsReady and the Ready
+// condition aggregated the same way the reconciler aggregates its components.
+// An error is only returned when the pods cannot be listed.
+func ComputeStatus(ctx context.Context, c client.Reader, app appv1beta1.Application) (appv1beta1.ApplicationStatus, error) {
+	if _, ok := ctx.Value(loggerCtxKey).(logr.Logger); !ok {
+		logger := ctrl.Log.WithName("controllers").WithName("Application").WithValues("application", app.Namespace+"/"+app.Name)
+		ctx = context.WithValue(ctx, loggerCtxKey, logger)
+	}
+
+	var resources []*unstructured.Unstructured
+	if app.Spec.Selector != nil {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("PodList"))
+		if err := c.List(ctx, list, client.InNamespace(app.Namespace), client.MatchingLabels(app.Spec.Selector.MatchLabels)); err != nil {
+			return appv1beta1.ApplicationStatus{}, err
+		}
+		for _, u := range list.Items {
+			resource := u
+			resources = append(resources, &resource)
+		}
+	}
+
+	var errs []error
+	status := getNewApplicationStatus(ctx, &app, resources, &errs)
+	status.ObservedGeneration = app.Generation
+	return *status, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Kubernetes Authors.
+// SPDX-License-Identifier: Apache-2.0
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	core "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	appv1beta1 "sigs.k8s.io/application/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+var _ = Describe("ComputeStatus", func() {
+	var labelSet = map[string]string{"app": "compute-status"}
+	var app appv1beta1.Application
+
+	BeforeEach(func() {
+		app = appv1beta1.Application{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceDefault, Name: "compute-status", Generation: 3},
+			Spec: appv1beta1.ApplicationSpec{
+				Selector: metav1.SetAsLabelSelector(labelSet),
+			},
+		}
+	})
+
+	newPod := func(name string, ready bool) *core.Pod {
+		pod := &core.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: metav1.NamespaceDefault, Name: name, Labels: labelSet},
+		}
+		if ready {
+			pod.Status.Conditions = []core.PodCondition{{Type: core.PodReady, Status: core.ConditionTrue}}
+		}
+		return pod
+	}
+
+	computeStatus := func(objs ...runtime.Object) appv1beta1.ApplicationStatus {
+		c := fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+		status, err := ComputeStatus(context.TODO(), c, app)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.ObservedGeneration).To(Equal(int64(3)))
+		return status
+	}
+
+	readyCondition := func(status appv1beta1.ApplicationStatus) appv1beta1.Condition {
+		for _, c := range status.Conditions {
+			if c.Type == appv1beta1.Ready {
+				return c
+			}
+		}
+		Fail("no Ready condition")
+		return appv1beta1.Condition{}
+	}
+
+	It("should be ready when all matched pods are ready", func() {
+		status := computeStatus(newPod("pod-1", true), newPod("pod-2", true))
+		Expect(status.ComponentsReady).To(Equal("2/2"))
+		Expect(status.ComponentList.Objects).To(HaveLen(2))
+		Expect(readyCondition(status).Status).To(Equal(core.ConditionTrue))
+		Expect(readyCondition(status).Reason).To(Equal("ComponentsReady"))
+	})
+
+	It("should not be ready when some matched pods are not ready", func() {
+		status := computeStatus(newPod("pod-1", true), newPod("pod-2", false))
+		Expect(status.ComponentsReady).To(Equal("1/2"))
+		Expect(readyCondition(status).Status).To(Equal(core.ConditionFalse))
+		Expect(readyCondition(status).Reason).To(Equal("ComponentsNotReady"))
+	})
+
+	It("should treat an Application without components like the reconciler does", func() {
+		status := computeStatus()
+		Expect(status.ComponentsReady).To(Equal("0/0"))
+		Expect(status.ComponentList.Objects).To(BeEmpty())
+		Expect(readyCondition(status).Status).To(Equal(core.ConditionTrue))
+	})
+})
@@ -0,0 +1,77 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ScrapeReport summarizes a one-off scrape run by DebugHandler.
+type ScrapeReport struct {
+	Applications int `json:"applications"`
+	Pods         int `json:"pods"`
+	Metrics      int `json:"metrics"`
+	// Errors maps namespaces to the errors collecting their Applications.
+	Errors          map[string][]string `json:"errors,omitempty"`
+	DurationSeconds float64             `json:"durationSeconds"`
+}
+
+// DebugHandler runs a one-off scrape on every request, e.g. on /scrape/debug,
+// and serves a ScrapeReport as JSON. Unlike Collect it carries on past
+// Applications whose pods can't be listed, and it leaves the state kept
+// across regular scrapes untouched.
+func (e *Exporter) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := e.options.Log.WithValues("handler", "scrape-debug")
+		ctx := context.WithValue(r.Context(), loggerCtxKey, logger)
+
+		report, err := e.debugScrape(ctx)
+		if err != nil {
+			logger.Error(err, "unable to list Applications")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.Error(err, "unable to write scrape report")
+		}
+	})
+}
+
+func (e *Exporter) debugScrape(ctx context.Context) (*ScrapeReport, error) {
+	start := time.Now()
+	appList, err := e.gather(ctx, &client.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ScrapeReport{Applications: len(appList.Items)}
+	cache := &scrapeCache{oneOff: true}
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for range ch {
+			report.Metrics++
+		}
+		close(done)
+	}()
+	for _, application := range appList.Items {
+		if err := e.collectApplicationMetrics(ctx, ch, cache, application); err != nil {
+			if report.Errors == nil {
+				report.Errors = map[string][]string{}
+			}
+			report.Errors[application.Namespace] = append(report.Errors[application.Namespace], err.Error())
+		}
+	}
+	close(ch)
+	<-done
+
+	report.Pods = cache.pods
+	report.DurationSeconds = time.Since(start).Seconds()
+	return report, nil
+}
@@ -0,0 +1,59 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	appv1beta1 "sigs.k8s.io/application/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// podListErrorClient fails listing pods in one namespace.
+type podListErrorClient struct {
+	client.Client
+	namespace string
+}
+
+func (c podListErrorClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	if _, ok := list.(*appv1beta1.ApplicationList); !ok && listOpts.Namespace == c.namespace {
+		return errors.New("connection refused")
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestDebugHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme,
+		newApplication("default", "web", web),
+		newPod("default", "web-0", web, "nginx"),
+		newPod("default", "web-1", web, "nginx"),
+		newApplication("broken", "web", web),
+	)
+	e := newTestExporter(g, Options{Client: podListErrorClient{Client: c, namespace: "broken"}})
+	server := httptest.NewServer(e.DebugHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/scrape/debug")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	defer resp.Body.Close()
+	g.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+
+	var report ScrapeReport
+	g.Expect(json.NewDecoder(resp.Body).Decode(&report)).To(gomega.Succeed())
+	g.Expect(report.Applications).To(gomega.Equal(2))
+	g.Expect(report.Pods).To(gomega.Equal(2))
+	g.Expect(report.Metrics).To(gomega.BeNumerically(">", 0))
+	g.Expect(report.Errors).To(gomega.Equal(map[string][]string{"broken": {"connection refused"}}))
+	g.Expect(report.DurationSeconds).To(gomega.BeNumerically(">", 0))
+}
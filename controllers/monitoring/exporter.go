@@ -2,91 +2,2164 @@ package monitoring
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
 	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	appv1beta1 "sigs.k8s.io/application/api/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
+var defaultSystemNamespaces = []string{"kube-system", "kube-public", "kube-node-lease"}
+
+// DefaultScrapeLatencyBuckets are the default buckets of
+// kube_application_scrape_duration_seconds.
+var DefaultScrapeLatencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// podFailureReasons are the reasons reported as-is by
+// kube_application_pod_failure_reason; others are reported as "other".
+var podFailureReasons = map[string]bool{
+	"Evicted":                    true,
+	"OOMKilled":                  true,
+	"Error":                      true,
+	"DeadlineExceeded":           true,
+	"ContainerCannotRun":         true,
+	"CrashLoopBackOff":           true,
+	"ErrImagePull":               true,
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// defaultReconcileErrorReasons are the Error condition reasons reported as-is
+// by kube_application_reconcile_error.
+var defaultReconcileErrorReasons = []string{"ErrorSeen", "ComponentNotFound"}
+
 const (
 	loggerCtxKey = "exporterLogger"
+
+	// unscheduledNode is the node label value for pods without Spec.NodeName.
+	unscheduledNode = "unscheduled"
+
+	// noPriorityClass is the priority_class label value for pods without one.
+	noPriorityClass = "none"
+
+	// unknownTeam is the team label value for Applications without TeamAnnotation.
+	unknownTeam = "unknown"
+
+	// envSourceSecret and envSourceConfigMap are the source label values of
+	// kube_application_container_env_sources.
+	envSourceSecret    = "secret"
+	envSourceConfigMap = "configmap"
+
+	// otherReconcileErrorReason is the reason label value for Error condition
+	// reasons outside the known set.
+	otherReconcileErrorReason = "other"
+
+	// noOwner is the owner_kind and owner_name label value of kube_pod_owner
+	// for pods without a controller owner under WorkloadOwnerResolver.
+	noOwner = "<none>"
+
+	// manageableFieldManager is the field manager of the CheckManageable
+	// dry-run patches.
+	manageableFieldManager = "application-exporter"
+
+	// defaultRegistry is the registry of images without an explicit host.
+	defaultRegistry = "docker.io"
+
+	// jobComplete, jobFailed and jobActive are the status label values of
+	// kube_application_job_completion.
+	jobComplete = "complete"
+	jobFailed   = "failed"
+	jobActive   = "active"
+
+	// otherPodFailureReason is the reason label value for pod failure reasons
+	// outside podFailureReasons.
+	otherPodFailureReason = "other"
+
+	// defaultServiceAccount is the service account pods run as when none is set.
+	defaultServiceAccount = "default"
+
+	defaultHealthCheckTimeout = 2 * time.Second
+
+	defaultRestartThreshold = 5
+
+	defaultStreamInterval = 30 * time.Second
+
+	defaultDescriptorLinkTimeout = 5 * time.Second
+
+	// maxListRestarts bounds how often a paginated List is restarted after its
+	// continue token expired before the scrape is failed.
+	maxListRestarts = 3
 )
 
 type Exporter struct {
-	options                 Options
-	KubePodOwner            *prometheus.Desc
-	ExporterLastScrapeError *prometheus.Desc
+	options          Options
+	systemNamespaces map[string]bool
+	// reconcileErrorReasons are the Error condition reasons reported as-is.
+	reconcileErrorReasons map[string]bool
+	trustedRegistries     map[string]bool
+	// extraPodRequirements are the ExtraPodSelector requirements.
+	extraPodRequirements []labels.Requirement
+	// scrapeLatency observes how long collecting each Application takes.
+	scrapeLatency *prometheus.HistogramVec
+	mu            sync.Mutex
+	lastScrapeErr error
+	// snapshot is the Application list served until CacheTTL passes after
+	// snapshotTime; guarded by mu.
+	snapshot     *appv1beta1.ApplicationList
+	snapshotTime time.Time
+	listRestarts uint64
+	// lastErrorLog is when a scrape failure was last logged, zero since the
+	// last successful scrape; guarded by mu.
+	lastErrorLog time.Time
+	// matchedPods remembers each Application's matched pod count from the
+	// previous scrape; guarded by mu.
+	matchedPods map[types.NamespacedName]int
+	// expected are the Applications set by SetExpectedApplications; guarded
+	// by mu.
+	expected []types.NamespacedName
+	// latencyNames remembers the application label each Application's
+	// scrape latency is observed with; guarded by mu.
+	latencyNames map[types.NamespacedName]string
+	// displayNameClashes are the Applications whose displayName clashed
+	// with another Application's in the last scrape; guarded by mu.
+	displayNameClashes                       map[types.NamespacedName]bool
+	KubePodOwner                             *prometheus.Desc
+	ExporterLastScrapeError                  *prometheus.Desc
+	KubeApplicationComponentPresent          *prometheus.Desc
+	KubeApplicationPodNode                   *prometheus.Desc
+	KubeApplicationOrphaned                  *prometheus.Desc
+	KubeApplicationSpecHash                  *prometheus.Desc
+	KubeApplicationImagePodCount             *prometheus.Desc
+	KubeApplicationStatusLastUpdate          *prometheus.Desc
+	KubeApplicationContainerProbes           *prometheus.Desc
+	KubeApplicationListRestartTotal          *prometheus.Desc
+	KubeApplicationZones                     *prometheus.Desc
+	KubeApplicationMatchedPodsDelta          *prometheus.Desc
+	KubeApplicationMissingReady              *prometheus.Desc
+	KubeApplicationPodsByPriority            *prometheus.Desc
+	KubeApplicationServiceType               *prometheus.Desc
+	KubeApplicationPodTolerations            *prometheus.Desc
+	KubeApplicationMainImage                 *prometheus.Desc
+	KubeApplicationCountByTeam               *prometheus.Desc
+	KubeApplicationDegradedPods              *prometheus.Desc
+	KubeApplicationExporterConfig            *prometheus.Desc
+	KubeApplicationWorkloads                 *prometheus.Desc
+	KubeApplicationPodsDefaultSA             *prometheus.Desc
+	KubeApplicationAddOwnerRef               *prometheus.Desc
+	KubeApplicationComponentsMissingOwnerRef *prometheus.Desc
+	KubeApplicationContainerEnvSources       *prometheus.Desc
+	KubeApplicationComponentKindMismatch     *prometheus.Desc
+	KubeApplicationPodsWithoutLimits         *prometheus.Desc
+	KubeApplicationWorkload                  *prometheus.Desc
+	KubeApplicationReconcileError            *prometheus.Desc
+	KubeApplicationSelectorOverlap           *prometheus.Desc
+	KubeApplicationUntrustedImages           *prometheus.Desc
+	KubeApplicationPodPVCs                   *prometheus.Desc
+	KubeApplicationConditions                *prometheus.Desc
+	KubeApplicationBrokenLinks               *prometheus.Desc
+	KubeApplicationForeignOwnedPods          *prometheus.Desc
+	KubeApplicationCacheAge                  *prometheus.Desc
+	KubeApplicationActivePods                *prometheus.Desc
+	KubeApplicationPrivilegedContainers      *prometheus.Desc
+	KubeApplicationPhaseCount                *prometheus.Desc
+	KubeApplicationNotManageable             *prometheus.Desc
+	KubeApplicationPodsReadinessGates        *prometheus.Desc
+	KubeApplicationPhaseDuration             *prometheus.Desc
+	KubeApplicationJobCompletion             *prometheus.Desc
+	KubeApplicationPodFailureReason          *prometheus.Desc
+	KubeApplicationExpectedMissing           *prometheus.Desc
+}
+
+// scrapeCache holds lookups shared by all Applications within one Collect.
+type scrapeCache struct {
+	// nodeZones maps node names to their zone, nil until first needed.
+	nodeZones map[string]string
+	// nodeZonesErr is the error listing Nodes failed with, which is not
+	// retried within the scrape.
+	nodeZonesErr error
+	// oneOff marks a targeted collection outside the regular scrapes, which
+	// must not advance the state kept across scrapes.
+	oneOff bool
+	// podSets maps each Application of a namespace to the names of its
+	// selected pods, only recorded with DetectSelectorOverlap.
+	podSets map[string]map[string]map[string]bool
+	// pods counts the pods selected by the collected Applications.
+	pods int
+	// namespaceLabels maps namespaces to their NamespaceLabels values.
+	namespaceLabels map[string][]string
+	// podOwners marks the kube_pod_owner series emitted, as pods selected by
+	// several Applications may resolve to the same owner.
+	podOwners map[string]bool
+}
+
+// OwnerResolver determines the owner_kind, owner_name and owner_is_controller
+// labels of kube_pod_owner for a pod selected by app. A pod selected by
+// several Applications resolving to the same owner is reported once.
+type OwnerResolver interface {
+	Resolve(pod v1.Pod, app appv1beta1.Application) (kind, name string, isController bool)
+}
+
+// ApplicationOwnerResolver reports the selecting Application as the
+// controlling owner of every pod. It is the default OwnerResolver.
+type ApplicationOwnerResolver struct {
+	// UseDisplayName reports the Application's descriptor displayName, if
+	// set, as owner_name instead of its name.
+	UseDisplayName bool
+	// name, if set, overrides UseDisplayName; the exporter sets it to fall
+	// back to the name on displayName clashes.
+	name func(appv1beta1.Application) string
+}
+
+func (r ApplicationOwnerResolver) Resolve(pod v1.Pod, app appv1beta1.Application) (string, string, bool) {
+	if r.name != nil {
+		return appv1beta1.ResourceKindApplication, r.name(app), true
+	}
+	return appv1beta1.ResourceKindApplication, applicationName(app, r.UseDisplayName), true
+}
+
+// WorkloadOwnerResolver reports the controller reference of every pod as its
+// owner, like kube-state-metrics, or "<none>" for pods without one.
+type WorkloadOwnerResolver struct{}
+
+func (WorkloadOwnerResolver) Resolve(pod v1.Pod, app appv1beta1.Application) (string, string, bool) {
+	ref := metav1.GetControllerOf(&pod)
+	if ref == nil {
+		return noOwner, noOwner, false
+	}
+	return ref.Kind, ref.Name, true
 }
 
 type Options struct {
 	Log         logr.Logger
 	Client      client.Client
 	ConstLabels prometheus.Labels
+	// Mapper resolves the Application's ComponentGroupKinds to listable GVKs.
+	// It is required when CheckComponentPresence or CheckComponentKindMismatch
+	// is enabled; without it, missing owner references are not reported.
+	Mapper meta.RESTMapper
+	// CheckComponentPresence enables kube_application_component_present. It
+	// costs one List per declared component kind per Application on every scrape.
+	CheckComponentPresence bool
+	// DeterministicOrder sorts Applications by namespace and name, and pods by
+	// name, before emitting so that Collect output is stable across runs.
+	DeterministicOrder bool
+	// ClientQPS and ClientBurst override the client-go rate limits of the
+	// client built by NewAppExporterFromConfig. They are ignored when Client is
+	// injected, since the caller then owns the client's configuration.
+	ClientQPS   float32
+	ClientBurst int
+	// ShardIndex and ShardTotal split Applications across exporter replicas:
+	// a replica only collects the Applications whose namespace/name hashes to
+	// its ShardIndex modulo ShardTotal. A ShardTotal of 0 or 1 disables sharding.
+	ShardIndex int
+	ShardTotal int
+	// ExcludeSystemNamespaces skips Applications in SystemNamespaces, which
+	// defaults to kube-system, kube-public and kube-node-lease when empty.
+	ExcludeSystemNamespaces bool
+	SystemNamespaces        []string
+	// HealthCheckLightweight makes Healthz list a single Application under
+	// HealthCheckTimeout instead of reporting the outcome of the last scrape,
+	// so API connectivity loss is caught without waiting for the next scrape.
+	HealthCheckLightweight bool
+	HealthCheckTimeout     time.Duration
+	// ApplicationFilter, when set, restricts collection to the Applications
+	// for which it returns true. It runs after the built-in filters.
+	ApplicationFilter func(appv1beta1.Application) bool
+	// ListPageSize lists Applications in chunks of this many items. A List
+	// whose continue token expires mid-way is restarted from the beginning.
+	// 0 lists everything in a single request.
+	ListPageSize int64
+	// PodAnnotationFilter, when set, limits kube_pod_owner to pods carrying
+	// all of the given annotation key/values.
+	PodAnnotationFilter map[string]string
+	// CollectZones enables kube_application_zones, which lists all Nodes once
+	// per scrape to resolve the zone of each selected pod.
+	CollectZones bool
+	// EmitScrapeErrorOnSuccess resets exporter_last_scrape_error to 0, with an
+	// empty err label, after a successful scrape so alerts on it resolve.
+	// Defaults to true when nil.
+	EmitScrapeErrorOnSuccess *bool
+	// MainContainerAnnotation names the pod annotation holding the name of the
+	// pod's main container, reported by kube_application_main_image. Pods
+	// without it, or naming an unknown container, fall back to their first one.
+	MainContainerAnnotation string
+	// TeamAnnotation names the Application annotation holding its owning
+	// team. It enables kube_application_count_by_team.
+	TeamAnnotation string
+	// RestartThreshold is the container restart count above which a pod
+	// counts as degraded. Defaults to 5 when 0.
+	RestartThreshold int32
+	// OwnerResolver customizes the owner labels of kube_pod_owner. Defaults to
+	// ApplicationOwnerResolver.
+	OwnerResolver OwnerResolver
+	// StreamInterval is the default period between topology snapshots on the
+	// gRPC StreamApplications RPC. Defaults to 30s when 0.
+	StreamInterval time.Duration
+	// ExtraPodSelector is ANDed onto every Application's pod selector, e.g. to
+	// scope the exporter to a single tenant's pods.
+	ExtraPodSelector map[string]string
+	// CheckComponentKindMismatch enables kube_application_component_kind_mismatch.
+	// Like CheckComponentPresence, it costs one List per declared component
+	// kind per Application on every scrape.
+	CheckComponentKindMismatch bool
+	// ErrorLogInterval rate-limits the error log of failed scrapes: the first
+	// failure after a successful scrape is logged, later ones at most once per
+	// interval. The scrape error metric is emitted on every scrape regardless.
+	// Every failure is logged when 0.
+	ErrorLogInterval time.Duration
+	// AggregateByWorkload replaces the per-pod kube_pod_owner series with one
+	// kube_application_workload series per top-level workload, counting its
+	// pods, to cut cardinality on large clusters.
+	AggregateByWorkload bool
+	// ReconcileErrorReasons extends the Error condition reasons reported as-is
+	// by kube_application_reconcile_error; other reasons are reported as
+	// "other" to bound cardinality.
+	ReconcileErrorReasons []string
+	// MinPods skips kube_pod_owner, or kube_application_workload with
+	// AggregateByWorkload, for Applications selecting fewer pods. The
+	// Applications are still counted by the Application level metrics.
+	MinPods int
+	// DetectSelectorOverlap enables kube_application_selector_overlap. It
+	// compares the selected pods of every pair of Applications in a namespace.
+	DetectSelectorOverlap bool
+	// TrustedRegistries are the registry hosts, e.g. "docker.io" or
+	// "gcr.io", of the images kube_application_untrusted_images treats as
+	// trusted. The metric is only emitted when set.
+	TrustedRegistries []string
+	// NamespaceLabels are the label keys of the Namespace objects copied onto
+	// kube_pod_owner, e.g. "env" as ns_label_env. Each Namespace is fetched
+	// once per scrape.
+	NamespaceLabels []string
+	// UseWorkloadOwnerForKubePodOwner reports the pods' controller owners on
+	// kube_pod_owner, matching kube-state-metrics, by defaulting
+	// OwnerResolver to WorkloadOwnerResolver.
+	UseWorkloadOwnerForKubePodOwner bool
+	// ScrapeLatencyBuckets are the buckets of
+	// kube_application_scrape_duration_seconds, in increasing order. Defaults
+	// to DefaultScrapeLatencyBuckets.
+	ScrapeLatencyBuckets []float64
+	// CheckDescriptorLinks enables kube_application_broken_links. It sends a
+	// HEAD request to every descriptor link of every Application on each
+	// scrape, each bounded by DescriptorLinkTimeout.
+	CheckDescriptorLinks bool
+	// DescriptorLinkTimeout bounds each descriptor link check. Defaults to 5s
+	// when 0.
+	DescriptorLinkTimeout time.Duration
+	// CacheTTL makes scrapes reuse a snapshot of the listed Applications for
+	// up to the TTL instead of listing them every time, reporting its age as
+	// kube_application_cache_age_seconds. Disabled when 0.
+	CacheTTL time.Duration
+	// Clock tells the time of snapshots. Defaults to the real clock.
+	Clock clock.Clock
+	// ActiveLabel is the pod label marking the active instance of an
+	// active/standby Application with a true value, as parsed by
+	// strconv.ParseBool. kube_application_active_pods is only emitted when set.
+	ActiveLabel string
+	// MetricHook, if set, is applied to every metric Collect emits before it
+	// is sent, e.g. to relabel it. Metrics it returns nil for are dropped.
+	MetricHook func(prometheus.Metric) prometheus.Metric
+	// CheckManageable enables kube_application_not_manageable by running
+	// Exporter.CheckManageable for every Application on each scrape.
+	CheckManageable bool
+	// UseDisplayName reports the Application's descriptor displayName, if
+	// set, instead of its name as the application label, and as owner_name
+	// with the default OwnerResolver. Applications whose displayName equals
+	// the displayName or name of another Application in their namespace keep
+	// their name as the application label, so series stay unique.
+	UseDisplayName bool
+	// KubePodOwnerAsGauge emits kube_pod_owner as a gauge of 1, like
+	// kube-state-metrics, so queries mixing both behave the same. It is a
+	// counter by default for compatibility, which rate() and increase() treat
+	// as never increasing, although the series says nothing about events.
+	KubePodOwnerAsGauge bool
+}
+
+// NewAppExporterFromConfig builds the exporter's client from config, applying
+// ClientQPS and ClientBurst, unless opts.Client is already set.
+func NewAppExporterFromConfig(config rest.Config, opts Options) (*Exporter, error) {
+	if opts.Client == nil {
+		cfg := clientConfig(config, opts)
+		if opts.Mapper == nil {
+			mapper, err := apiutil.NewDynamicRESTMapper(cfg, apiutil.WithLazyDiscovery)
+			if err != nil {
+				return nil, fmt.Errorf("unable to create REST mapper: %v", err)
+			}
+			opts.Mapper = mapper
+		}
+
+		scheme := runtime.NewScheme()
+		if err := clientgoscheme.AddToScheme(scheme); err != nil {
+			return nil, err
+		}
+		if err := appv1beta1.AddToScheme(scheme); err != nil {
+			return nil, err
+		}
+
+		c, err := client.New(cfg, client.Options{Scheme: scheme, Mapper: opts.Mapper})
+		if err != nil {
+			return nil, fmt.Errorf("unable to create client: %v", err)
+		}
+		opts.Client = c
+	}
+	return NewAppExporter(opts)
+}
+
+func clientConfig(config rest.Config, opts Options) *rest.Config {
+	cfg := rest.CopyConfig(&config)
+	if opts.ClientQPS > 0 {
+		cfg.QPS = opts.ClientQPS
+	}
+	if opts.ClientBurst > 0 {
+		cfg.Burst = opts.ClientBurst
+	}
+	return cfg
 }
 
 func NewAppExporter(opts Options) (*Exporter, error) {
-	return &Exporter{
-		options: opts,
+	if opts.ShardTotal > 1 && (opts.ShardIndex < 0 || opts.ShardIndex >= opts.ShardTotal) {
+		return nil, fmt.Errorf("shard index %d out of range for %d shards", opts.ShardIndex, opts.ShardTotal)
+	}
+	if opts.CheckComponentPresence && opts.Mapper == nil {
+		return nil, fmt.Errorf("CheckComponentPresence requires a Mapper")
+	}
+	if opts.CheckComponentKindMismatch && opts.Mapper == nil {
+		return nil, fmt.Errorf("CheckComponentKindMismatch requires a Mapper")
+	}
+	defaultResolver := opts.OwnerResolver == nil
+	if defaultResolver {
+		opts.OwnerResolver = ApplicationOwnerResolver{UseDisplayName: opts.UseDisplayName}
+		if opts.UseWorkloadOwnerForKubePodOwner {
+			opts.OwnerResolver = WorkloadOwnerResolver{}
+		}
+	} else if opts.UseWorkloadOwnerForKubePodOwner {
+		return nil, fmt.Errorf("UseWorkloadOwnerForKubePodOwner conflicts with a custom OwnerResolver")
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.RealClock{}
+	}
+	buckets := opts.ScrapeLatencyBuckets
+	if len(buckets) == 0 {
+		buckets = DefaultScrapeLatencyBuckets
+	}
+	for i := 1; i < len(buckets); i++ {
+		if buckets[i] <= buckets[i-1] {
+			return nil, fmt.Errorf("scrape latency buckets must be in increasing order, got %v", buckets)
+		}
+	}
+	systemNamespaces := map[string]bool{}
+	if opts.ExcludeSystemNamespaces {
+		namespaces := opts.SystemNamespaces
+		if len(namespaces) == 0 {
+			namespaces = defaultSystemNamespaces
+		}
+		for _, ns := range namespaces {
+			systemNamespaces[ns] = true
+		}
+	}
+	reconcileErrorReasons := map[string]bool{}
+	for _, reason := range append(append([]string{}, defaultReconcileErrorReasons...), opts.ReconcileErrorReasons...) {
+		reconcileErrorReasons[reason] = true
+	}
+	var extraPodRequirements []labels.Requirement
+	for key, value := range opts.ExtraPodSelector {
+		requirement, err := labels.NewRequirement(key, selection.Equals, []string{value})
+		if err != nil {
+			return nil, fmt.Errorf("invalid extra pod selector: %v", err)
+		}
+		extraPodRequirements = append(extraPodRequirements, *requirement)
+	}
+	seenLabels := map[string]string{}
+	for i, name := range namespaceLabelNames(opts.NamespaceLabels) {
+		if key, ok := seenLabels[name]; ok {
+			return nil, fmt.Errorf("namespace labels %q and %q both map to label %s", key, opts.NamespaceLabels[i], name)
+		}
+		seenLabels[name] = opts.NamespaceLabels[i]
+	}
+	trustedRegistries := map[string]bool{}
+	for _, registry := range opts.TrustedRegistries {
+		trustedRegistries[registry] = true
+	}
+	e := &Exporter{
+		options:               opts,
+		systemNamespaces:      systemNamespaces,
+		reconcileErrorReasons: reconcileErrorReasons,
+		trustedRegistries:     trustedRegistries,
+		extraPodRequirements:  extraPodRequirements,
+		scrapeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:        "kube_application_scrape_duration_seconds",
+			Help:        "Time taken to collect the metrics of an Application.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     buckets,
+		}, []string{"namespace", "application"}),
+		matchedPods:  map[types.NamespacedName]int{},
+		latencyNames: map[types.NamespacedName]string{},
 		KubePodOwner: prometheus.NewDesc(
 			"kube_pod_owner",
 			"kube pod owner",
-			[]string{"container", "namespace", "owner_is_controller", "owner_kind", "owner_name", "pod"}, opts.ConstLabels,
+			append([]string{"container", "namespace", "owner_is_controller", "owner_kind", "owner_name", "pod"}, namespaceLabelNames(opts.NamespaceLabels)...), opts.ConstLabels,
 		),
 		ExporterLastScrapeError: prometheus.NewDesc(
 			"exporter_last_scrape_error",
 			"The last scrape error status.",
 			[]string{"err"}, opts.ConstLabels,
 		),
-	}, nil
+		KubeApplicationComponentPresent: prometheus.NewDesc(
+			"kube_application_component_present",
+			"Whether at least one object of a declared component kind matches the Application selector.",
+			[]string{"namespace", "application", "group", "kind"}, opts.ConstLabels,
+		),
+		KubeApplicationPodNode: prometheus.NewDesc(
+			"kube_application_pod_node",
+			"The node a pod selected by the Application is scheduled on.",
+			[]string{"namespace", "application", "pod", "node"}, opts.ConstLabels,
+		),
+		KubeApplicationOrphaned: prometheus.NewDesc(
+			"kube_application_orphaned",
+			"Whether the Application has no owner references.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationSpecHash: prometheus.NewDesc(
+			"kube_application_spec_hash",
+			"Information about the Application spec; the hash label changes whenever the spec does.",
+			[]string{"namespace", "application", "hash"}, opts.ConstLabels,
+		),
+		KubeApplicationImagePodCount: prometheus.NewDesc(
+			"kube_application_image_pod_count",
+			"Number of pods selected by the Application running a container image.",
+			[]string{"namespace", "application", "image"}, opts.ConstLabels,
+		),
+		KubeApplicationStatusLastUpdate: prometheus.NewDesc(
+			"kube_application_status_last_update",
+			"Unix timestamp of the most recent Application condition update, 0 if unknown.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationContainerProbes: prometheus.NewDesc(
+			"kube_application_container_probes",
+			"Whether a liveness, readiness or startup probe is configured on a container.",
+			[]string{"namespace", "application", "pod", "container", "probe"}, opts.ConstLabels,
+		),
+		KubeApplicationListRestartTotal: prometheus.NewDesc(
+			"kube_application_list_restart_total",
+			"Number of paginated Application Lists restarted because their continue token expired.",
+			nil, opts.ConstLabels,
+		),
+		KubeApplicationZones: prometheus.NewDesc(
+			"kube_application_zones",
+			"Number of distinct availability zones the pods selected by the Application run in.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationMatchedPodsDelta: prometheus.NewDesc(
+			"kube_application_matched_pods_delta",
+			"Change in the number of pods selected by the Application since the previous scrape.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationMissingReady: prometheus.NewDesc(
+			"kube_application_missing_ready_condition",
+			"Whether the Application status has no Ready condition.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationPodsByPriority: prometheus.NewDesc(
+			"kube_application_pods_by_priority_class",
+			"Number of pods selected by the Application per priority class.",
+			[]string{"namespace", "application", "priority_class"}, opts.ConstLabels,
+		),
+		KubeApplicationServiceType: prometheus.NewDesc(
+			"kube_application_service_type",
+			"The type of a Service selected by the Application.",
+			[]string{"namespace", "application", "service", "type"}, opts.ConstLabels,
+		),
+		KubeApplicationPodTolerations: prometheus.NewDesc(
+			"kube_application_pod_tolerations",
+			"Number of tolerations on a pod selected by the Application.",
+			[]string{"namespace", "application", "pod"}, opts.ConstLabels,
+		),
+		KubeApplicationMainImage: prometheus.NewDesc(
+			"kube_application_main_image",
+			"The image of the main container of a pod selected by the Application.",
+			[]string{"namespace", "application", "pod", "container", "image"}, opts.ConstLabels,
+		),
+		KubeApplicationCountByTeam: prometheus.NewDesc(
+			"kube_application_count_by_team",
+			"Number of Applications per owning team.",
+			[]string{"team"}, opts.ConstLabels,
+		),
+		KubeApplicationDegradedPods: prometheus.NewDesc(
+			"kube_application_degraded_pods",
+			"Number of pods selected by the Application with a container restarted more often than the restart threshold.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationExporterConfig: prometheus.NewDesc(
+			"kube_application_exporter_config",
+			"Information about the scrape scope of this exporter.",
+			[]string{"namespace", "concurrency", "cache_ttl_seconds", "shard_index", "shard_total"}, opts.ConstLabels,
+		),
+		KubeApplicationWorkloads: prometheus.NewDesc(
+			"kube_application_distinct_workloads",
+			"Number of distinct top-level workloads owning the pods selected by the Application.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationPodsDefaultSA: prometheus.NewDesc(
+			"kube_application_pods_default_sa",
+			"Number of pods selected by the Application running as the default service account.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationAddOwnerRef: prometheus.NewDesc(
+			"kube_application_add_owner_ref",
+			"Whether the Application adds owner references to its components, by spec.addOwnerRef.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationComponentsMissingOwnerRef: prometheus.NewDesc(
+			"kube_application_components_missing_owner_ref",
+			"Number of components selected by an Application with spec.addOwnerRef that lack an owner reference to it.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationContainerEnvSources: prometheus.NewDesc(
+			"kube_application_container_env_sources",
+			"Number of envFrom and env keyRef entries of a container selected by the Application, by Secret or ConfigMap source.",
+			[]string{"namespace", "application", "pod", "container", "source"}, opts.ConstLabels,
+		),
+		KubeApplicationComponentKindMismatch: prometheus.NewDesc(
+			"kube_application_component_kind_mismatch",
+			"Whether the kinds of the resources selected by the Application differ from its declared componentKinds.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationPodsWithoutLimits: prometheus.NewDesc(
+			"kube_application_pods_without_limits",
+			"Number of pods selected by the Application with a container lacking a CPU or memory limit.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationWorkload: prometheus.NewDesc(
+			"kube_application_workload",
+			"Number of pods selected by the Application per top-level owning workload, emitted instead of kube_pod_owner with AggregateByWorkload.",
+			[]string{"namespace", "application", "workload_kind", "workload_name"}, opts.ConstLabels,
+		),
+		KubeApplicationReconcileError: prometheus.NewDesc(
+			"kube_application_reconcile_error",
+			"Reason of the Error condition the controller recorded on the Application.",
+			[]string{"namespace", "application", "reason"}, opts.ConstLabels,
+		),
+		KubeApplicationSelectorOverlap: prometheus.NewDesc(
+			"kube_application_selector_overlap",
+			"Whether the Application selects pods also selected by another Application in its namespace.",
+			[]string{"namespace", "application", "overlaps_with"}, opts.ConstLabels,
+		),
+		KubeApplicationUntrustedImages: prometheus.NewDesc(
+			"kube_application_untrusted_images",
+			"Number of pods selected by the Application with a container image from a registry outside TrustedRegistries.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationPodPVCs: prometheus.NewDesc(
+			"kube_application_pod_pvcs",
+			"Number of PersistentVolumeClaim volumes of a pod selected by the Application.",
+			[]string{"namespace", "application", "pod"}, opts.ConstLabels,
+		),
+		KubeApplicationConditions: prometheus.NewDesc(
+			"kube_application_conditions",
+			"Number of conditions of the Application by status.",
+			[]string{"namespace", "application", "status"}, opts.ConstLabels,
+		),
+		KubeApplicationBrokenLinks: prometheus.NewDesc(
+			"kube_application_broken_links",
+			"Whether a descriptor link of the Application failed a HEAD request.",
+			[]string{"namespace", "application", "url"}, opts.ConstLabels,
+		),
+		KubeApplicationForeignOwnedPods: prometheus.NewDesc(
+			"kube_application_foreign_owned_pods",
+			"Number of pods selected by the Application with an owner reference to a different Application.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationCacheAge: prometheus.NewDesc(
+			"kube_application_cache_age_seconds",
+			"Age of the Application list snapshot served with CacheTTL.",
+			nil, opts.ConstLabels,
+		),
+		KubeApplicationActivePods: prometheus.NewDesc(
+			"kube_application_active_pods",
+			"Number of pods selected by the Application marked active by ActiveLabel.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationPrivilegedContainers: prometheus.NewDesc(
+			"kube_application_privileged_containers",
+			"Number of pods selected by the Application with a privileged container or one running as root.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationPhaseCount: prometheus.NewDesc(
+			"kube_application_phase_count",
+			"Number of Applications per assembly phase.",
+			[]string{"phase"}, opts.ConstLabels,
+		),
+		KubeApplicationNotManageable: prometheus.NewDesc(
+			"kube_application_not_manageable",
+			"Whether a server-side apply dry-run of the Application failed, e.g. for lack of write access.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationPodsReadinessGates: prometheus.NewDesc(
+			"kube_application_pods_readiness_gates",
+			"Number of pods selected by the Application by readiness gate and the status of its condition.",
+			[]string{"namespace", "application", "gate", "status"}, opts.ConstLabels,
+		),
+		KubeApplicationPhaseDuration: prometheus.NewDesc(
+			"kube_application_phase_duration_seconds",
+			"Time since the last transition of the condition tracking the Application's assembly phase.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+		KubeApplicationJobCompletion: prometheus.NewDesc(
+			"kube_application_job_completion",
+			"Completion status of a Job selected by the Application, one of complete, failed or active.",
+			[]string{"namespace", "application", "job", "status"}, opts.ConstLabels,
+		),
+		KubeApplicationPodFailureReason: prometheus.NewDesc(
+			"kube_application_pod_failure_reason",
+			"Reason a Failed or Pending pod selected by the Application is not running, from the pod or its container statuses.",
+			[]string{"namespace", "application", "pod", "reason"}, opts.ConstLabels,
+		),
+		KubeApplicationExpectedMissing: prometheus.NewDesc(
+			"kube_application_expected_missing",
+			"Whether an Application set by SetExpectedApplications was not found.",
+			[]string{"namespace", "application"}, opts.ConstLabels,
+		),
+	}
+	if resolver, ok := e.options.OwnerResolver.(ApplicationOwnerResolver); ok && defaultResolver {
+		resolver.name = e.applicationName
+		e.options.OwnerResolver = resolver
+	}
+	return e, nil
 }
 func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- e.KubePodOwner
 	ch <- e.ExporterLastScrapeError
+	ch <- e.KubeApplicationComponentPresent
+	ch <- e.KubeApplicationPodNode
+	ch <- e.KubeApplicationOrphaned
+	ch <- e.KubeApplicationSpecHash
+	ch <- e.KubeApplicationImagePodCount
+	ch <- e.KubeApplicationStatusLastUpdate
+	ch <- e.KubeApplicationContainerProbes
+	ch <- e.KubeApplicationListRestartTotal
+	ch <- e.KubeApplicationZones
+	ch <- e.KubeApplicationMatchedPodsDelta
+	ch <- e.KubeApplicationMissingReady
+	ch <- e.KubeApplicationPodsByPriority
+	ch <- e.KubeApplicationServiceType
+	ch <- e.KubeApplicationPodTolerations
+	ch <- e.KubeApplicationMainImage
+	ch <- e.KubeApplicationCountByTeam
+	ch <- e.KubeApplicationDegradedPods
+	ch <- e.KubeApplicationExporterConfig
+	ch <- e.KubeApplicationWorkloads
+	ch <- e.KubeApplicationPodsDefaultSA
+	ch <- e.KubeApplicationAddOwnerRef
+	ch <- e.KubeApplicationComponentsMissingOwnerRef
+	ch <- e.KubeApplicationContainerEnvSources
+	ch <- e.KubeApplicationComponentKindMismatch
+	ch <- e.KubeApplicationPodsWithoutLimits
+	ch <- e.KubeApplicationWorkload
+	ch <- e.KubeApplicationReconcileError
+	ch <- e.KubeApplicationSelectorOverlap
+	ch <- e.KubeApplicationUntrustedImages
+	ch <- e.KubeApplicationPodPVCs
+	ch <- e.KubeApplicationConditions
+	e.scrapeLatency.Describe(ch)
+	ch <- e.KubeApplicationBrokenLinks
+	ch <- e.KubeApplicationForeignOwnedPods
+	ch <- e.KubeApplicationCacheAge
+	ch <- e.KubeApplicationActivePods
+	ch <- e.KubeApplicationPrivilegedContainers
+	ch <- e.KubeApplicationPhaseCount
+	ch <- e.KubeApplicationNotManageable
+	ch <- e.KubeApplicationPodsReadinessGates
+	ch <- e.KubeApplicationPhaseDuration
+	ch <- e.KubeApplicationJobCompletion
+	ch <- e.KubeApplicationPodFailureReason
+	ch <- e.KubeApplicationExpectedMissing
 }
 
 func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	if e.options.MetricHook != nil {
+		hooked := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func(out chan<- prometheus.Metric) {
+			defer close(done)
+			for m := range hooked {
+				if m = e.options.MetricHook(m); m != nil {
+					out <- m
+				}
+			}
+		}(ch)
+		defer func() {
+			close(hooked)
+			<-done
+		}()
+		ch = hooked
+	}
+
 	collectCtx := context.Background()
 	logger := e.options.Log.WithValues("collect", "application")
 	ctx := context.WithValue(collectCtx, loggerCtxKey, logger)
 
 	appGVK := appv1beta1.GroupVersion.WithKind(appv1beta1.ResourceKindApplication)
 
-	appList := &appv1beta1.ApplicationList{}
-	if err := e.options.Client.List(ctx, appList, &client.ListOptions{}); err != nil {
-		logger.Error(err, "unable to appList resources for GVK", "appGVK", appGVK)
+	e.collectExporterConfig(ch)
+	appList, age, err := e.gatherSnapshot(ctx)
+	e.setLastScrapeError(err)
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationListRestartTotal, prometheus.CounterValue, float64(atomic.LoadUint64(&e.listRestarts)))
+	if err != nil {
+		e.logScrapeError(logger, err, "unable to appList resources for GVK", "appGVK", appGVK)
 		e.registerExporterLastScrapeError(ctx, ch, 1.0, prometheus.GaugeValue, fmt.Sprintf("%s", err))
 		return
 	}
+	e.collectExpectedMissing(ch, appList.Items)
+	if e.options.UseDisplayName {
+		e.setDisplayNameClashes(appList.Items)
+	}
+	if e.options.CacheTTL > 0 {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationCacheAge, prometheus.GaugeValue, age.Seconds())
+	}
+	if e.options.DeterministicOrder {
+		sortApplications(appList.Items)
+	}
+	e.collectApplicationCounts(ch, appList.Items)
 
+	cache := &scrapeCache{}
 	for _, application := range appList.Items {
-		podList := &v1.PodList{}
-		if err := e.options.Client.List(ctx, podList, &client.ListOptions{
-			Namespace:     application.Namespace,
-			LabelSelector: labels.SelectorFromSet(application.Spec.Selector.MatchLabels),
-		}); err != nil {
-			logger.Error(err, "unable to appList resources for PodList")
+		start := time.Now()
+		err := e.collectApplicationMetrics(ctx, ch, cache, application)
+		e.observeScrapeLatency(application, time.Since(start))
+		if err != nil {
+			e.logScrapeError(logger, err, "unable to appList resources for PodList")
+			e.setLastScrapeError(err)
 			e.registerExporterLastScrapeError(ctx, ch, 1.0, prometheus.GaugeValue, fmt.Sprintf("%s", err))
 			return
 		}
+	}
+	e.pruneApplications(appList.Items)
+	e.scrapeLatency.Collect(ch)
+	if e.options.DetectSelectorOverlap {
+		e.collectSelectorOverlap(ch, cache)
+	}
+	e.resetErrorLog()
+
+	if e.options.EmitScrapeErrorOnSuccess == nil || *e.options.EmitScrapeErrorOnSuccess {
+		e.registerExporterLastScrapeError(ctx, ch, 0, prometheus.GaugeValue, "")
+	}
+}
+
+// collectExporterConfig reports the scrape scope. The exporter always watches
+// all namespaces and collects Applications one at a time, hence the fixed
+// namespace and concurrency; the cache TTL is Options.CacheTTL.
+func (e *Exporter) collectExporterConfig(ch chan<- prometheus.Metric) {
+	shardIndex, shardTotal := e.options.ShardIndex, e.options.ShardTotal
+	if shardTotal <= 1 {
+		shardIndex, shardTotal = 0, 1
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationExporterConfig, prometheus.GaugeValue, 1,
+		"all", "1", strconv.FormatFloat(e.options.CacheTTL.Seconds(), 'f', -1, 64), strconv.Itoa(shardIndex), strconv.Itoa(shardTotal))
+}
+
+// CollectOne returns the metrics of a single Application, bypassing the
+// Application filters. It does not advance state kept across scrapes, such as
+// the matched pods delta. A missing Application yields a NotFound error.
+func (e *Exporter) CollectOne(ctx context.Context, namespace, name string) ([]prometheus.Metric, error) {
+	logger := e.options.Log.WithValues("collect", "application", "application", namespace+"/"+name)
+	ctx = context.WithValue(ctx, loggerCtxKey, logger)
+
+	application := appv1beta1.Application{}
+	if err := e.options.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &application); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- e.collectApplicationMetrics(ctx, ch, &scrapeCache{oneOff: true}, application)
+		close(ch)
+	}()
+
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+// collectApplicationMetrics emits all metrics of one Application. It only
+// fails when the Application's pods cannot be listed.
+func (e *Exporter) collectApplicationMetrics(ctx context.Context, ch chan<- prometheus.Metric, cache *scrapeCache, application appv1beta1.Application) error {
+	e.collectApplication(ch, application)
+
+	pods, err := e.PodsForApplication(ctx, application)
+	if err != nil {
+		return err
+	}
+	cache.pods += len(pods)
+	if e.options.DeterministicOrder {
+		sortPods(pods)
+	}
+
+	if e.options.DetectSelectorOverlap {
+		cache.recordPods(application.Namespace, e.applicationName(application), pods)
+	}
+
+	ownerSeries := len(pods) >= e.options.MinPods
+	namespaceLabels := e.namespaceLabelValues(ctx, cache, application.Namespace)
+	for _, pod := range pods {
+		e.collectPod(ch, cache, application, pod, ownerSeries, namespaceLabels)
+	}
+	e.collectPodSummary(ctx, ch, cache, application, pods, ownerSeries)
+	e.collectServices(ctx, ch, application)
+	e.collectJobs(ctx, ch, application)
+
+	if e.options.CheckComponentPresence {
+		e.collectComponentPresence(ctx, ch, application)
+	}
+	if e.options.CheckDescriptorLinks {
+		e.collectBrokenLinks(ctx, ch, application)
+	}
+	if e.options.CheckManageable {
+		err := e.CheckManageable(ctx, application)
+		if err != nil {
+			getLoggerOrDie(ctx).Error(err, "Application is not manageable", "application", application.Namespace+"/"+application.Name)
+		}
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationNotManageable, prometheus.GaugeValue, boolFloat64(err != nil), application.Namespace, e.applicationName(application))
+	}
+	if e.options.CheckComponentKindMismatch {
+		e.collectComponentKindMismatch(ctx, ch, application, pods)
+	}
+	if application.Spec.AddOwnerRef && e.options.Mapper != nil {
+		e.collectMissingOwnerRefs(ctx, ch, application)
+	}
+	return nil
+}
+
+// gather lists the Applications the exporter is responsible for. It is shared
+// by Collect and the lightweight health check, which bounds it by a timeout.
+func (e *Exporter) gather(ctx context.Context, opts *client.ListOptions) (*appv1beta1.ApplicationList, error) {
+	appList, err := e.listApplications(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	appList.Items = e.filterApplications(appList.Items)
+	return appList, nil
+}
+
+// gatherSnapshot gathers all Applications, served from the snapshot while it
+// is younger than CacheTTL, and returns the age of the served list.
+func (e *Exporter) gatherSnapshot(ctx context.Context) (*appv1beta1.ApplicationList, time.Duration, error) {
+	if e.options.CacheTTL <= 0 {
+		appList, err := e.gather(ctx, &client.ListOptions{})
+		return appList, 0, err
+	}
+
+	e.mu.Lock()
+	snapshot, snapshotTime := e.snapshot, e.snapshotTime
+	e.mu.Unlock()
+	now := e.options.Clock.Now()
+	if snapshot != nil && now.Sub(snapshotTime) < e.options.CacheTTL {
+		return snapshot.DeepCopy(), now.Sub(snapshotTime), nil
+	}
+
+	appList, err := e.gather(ctx, &client.ListOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+	e.mu.Lock()
+	e.snapshot, e.snapshotTime = appList.DeepCopy(), now
+	e.mu.Unlock()
+	return appList, 0, nil
+}
+
+// listApplications lists Applications in pages of ListPageSize unless opts
+// already carries a Limit.
+func (e *Exporter) listApplications(ctx context.Context, opts *client.ListOptions) (*appv1beta1.ApplicationList, error) {
+	appList := &appv1beta1.ApplicationList{}
+	if opts.Limit > 0 || e.options.ListPageSize <= 0 {
+		if err := e.options.Client.List(ctx, appList, opts); err != nil {
+			return nil, err
+		}
+		return appList, nil
+	}
 
-		for _, pod := range podList.Items {
-			for _, container := range pod.Spec.Containers {
-				ch <- prometheus.MustNewConstMetric(e.KubePodOwner, prometheus.CounterValue, 1, container.Name, application.ObjectMeta.Namespace, "true", appGVK.Kind, application.ObjectMeta.Name, pod.Name)
+	restarts := 0
+	pageOpts := *opts
+	pageOpts.Limit = e.options.ListPageSize
+	for {
+		page := &appv1beta1.ApplicationList{}
+		err := e.options.Client.List(ctx, page, &pageOpts)
+		if err != nil {
+			if !apierrors.IsResourceExpired(err) || pageOpts.Continue == "" || restarts >= maxListRestarts {
+				return nil, err
 			}
+			getLoggerOrDie(ctx).Info("restarting Application list after its continue token expired", "restarts", restarts+1)
+			atomic.AddUint64(&e.listRestarts, 1)
+			restarts++
+			appList.Items = nil
+			pageOpts.Continue = ""
+			continue
+		}
+
+		appList.Items = append(appList.Items, page.Items...)
+		if page.Continue == "" {
+			return appList, nil
 		}
+		pageOpts.Continue = page.Continue
 	}
 }
 
-func (e *Exporter) registerExporterLastScrapeError(ctx context.Context, ch chan<- prometheus.Metric, val float64, valType prometheus.ValueType, labelValues ...string) {
-	logging := getLoggerOrDie(ctx)
-	if m, err := prometheus.NewConstMetric(e.ExporterLastScrapeError, valType, val, labelValues...); err == nil {
-		ch <- m
+// Healthz serves 200 when the exporter can reach the API server and 503 otherwise.
+func (e *Exporter) Healthz(w http.ResponseWriter, r *http.Request) {
+	var err error
+	if e.options.HealthCheckLightweight {
+		timeout := e.options.HealthCheckTimeout
+		if timeout <= 0 {
+			timeout = defaultHealthCheckTimeout
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		_, err = e.gather(ctx, &client.ListOptions{Limit: 1})
 	} else {
-		logging.Error(err, "unable to register exporter last scrape error")
+		e.mu.Lock()
+		err = e.lastScrapeErr
+		e.mu.Unlock()
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	_, _ = fmt.Fprint(w, "ok")
+}
+
+func (e *Exporter) setLastScrapeError(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastScrapeErr = err
+}
+
+// logScrapeError logs a failed scrape, sampled by ErrorLogInterval.
+func (e *Exporter) logScrapeError(logger logr.Logger, err error, msg string, keysAndValues ...interface{}) {
+	e.mu.Lock()
+	now := e.options.Clock.Now()
+	sampled := !e.lastErrorLog.IsZero() && now.Sub(e.lastErrorLog) < e.options.ErrorLogInterval
+	if !sampled {
+		e.lastErrorLog = now
+	}
+	e.mu.Unlock()
+
+	if !sampled {
+		logger.Error(err, msg, keysAndValues...)
+	}
+}
+
+// resetErrorLog makes the next scrape failure log again.
+func (e *Exporter) resetErrorLog() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastErrorLog = time.Time{}
+}
+
+// filterApplications drops the Applications this exporter is not responsible for.
+func (e *Exporter) filterApplications(apps []appv1beta1.Application) []appv1beta1.Application {
+	filtered := apps[:0]
+	for _, app := range apps {
+		if !e.inShard(app) || e.systemNamespaces[app.Namespace] {
+			continue
+		}
+		if e.options.ApplicationFilter != nil && !e.options.ApplicationFilter(app) {
+			continue
+		}
+		filtered = append(filtered, app)
+	}
+	return filtered
+}
+
+func (e *Exporter) inShard(app appv1beta1.Application) bool {
+	if e.options.ShardTotal <= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(app.Namespace + "/" + app.Name))
+	return int(h.Sum32()%uint32(e.options.ShardTotal)) == e.options.ShardIndex
+}
+
+// PodsForApplication lists the pods selected by the Application. An
+// Application without a selector selects no pods.
+func (e *Exporter) PodsForApplication(ctx context.Context, application appv1beta1.Application) ([]v1.Pod, error) {
+	if application.Spec.Selector == nil {
+		return nil, nil
+	}
+	selector := labels.SelectorFromSet(application.Spec.Selector.MatchLabels).Add(e.extraPodRequirements...)
+
+	podList := &v1.PodList{}
+	if err := e.options.Client.List(ctx, podList, &client.ListOptions{
+		Namespace:     application.Namespace,
+		LabelSelector: selector,
+	}); err != nil {
+		return nil, err
+	}
+	return podList.Items, nil
+}
+
+// SetExpectedApplications sets the desired inventory of Applications, e.g.
+// from GitOps sources, which kube_application_expected_missing reports on
+// from the next scrape. Applications outside this exporter's shard or in
+// excluded system namespaces are ignored; ApplicationFilter can't be applied
+// to Applications that don't exist, so those it rejects are reported missing.
+func (e *Exporter) SetExpectedApplications(keys []types.NamespacedName) {
+	var expected []types.NamespacedName
+	seen := map[types.NamespacedName]bool{}
+	for _, key := range keys {
+		if !seen[key] {
+			seen[key] = true
+			expected = append(expected, key)
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expected = expected
+}
+
+func (e *Exporter) collectExpectedMissing(ch chan<- prometheus.Metric, apps []appv1beta1.Application) {
+	e.mu.Lock()
+	expected := e.expected
+	e.mu.Unlock()
+	if len(expected) == 0 {
+		return
+	}
+
+	found := make(map[types.NamespacedName]bool, len(apps))
+	for _, app := range apps {
+		found[types.NamespacedName{Namespace: app.Namespace, Name: app.Name}] = true
+	}
+	for _, key := range expected {
+		app := appv1beta1.Application{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+		if !e.inShard(app) || e.systemNamespaces[key.Namespace] {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationExpectedMissing, prometheus.GaugeValue, boolFloat64(!found[key]), key.Namespace, key.Name)
+	}
+}
+
+// collectApplicationCounts emits the aggregates over all collected Applications.
+func (e *Exporter) collectApplicationCounts(ch chan<- prometheus.Metric, apps []appv1beta1.Application) {
+	phases := map[appv1beta1.ApplicationAssemblyPhase]int{}
+	for _, app := range apps {
+		phase := app.Spec.AssemblyPhase
+		if phase == "" {
+			phase = appv1beta1.Succeeded
+		}
+		phases[phase]++
+	}
+	// The known phases come first, always reported, then any others sorted,
+	// so the output order is stable.
+	order := []appv1beta1.ApplicationAssemblyPhase{appv1beta1.Pending, appv1beta1.Succeeded, appv1beta1.Failed}
+	var others []string
+	for phase := range phases {
+		if phase != appv1beta1.Pending && phase != appv1beta1.Succeeded && phase != appv1beta1.Failed {
+			others = append(others, string(phase))
+		}
+	}
+	sort.Strings(others)
+	for _, phase := range others {
+		order = append(order, appv1beta1.ApplicationAssemblyPhase(phase))
+	}
+	for _, phase := range order {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationPhaseCount, prometheus.GaugeValue, float64(phases[phase]), string(phase))
+	}
+
+	if e.options.TeamAnnotation != "" {
+		teams := map[string]int{}
+		for _, app := range apps {
+			team := app.Annotations[e.options.TeamAnnotation]
+			if team == "" {
+				team = unknownTeam
+			}
+			teams[team]++
+		}
+		for _, team := range e.countKeys(teams) {
+			ch <- prometheus.MustNewConstMetric(e.KubeApplicationCountByTeam, prometheus.GaugeValue, float64(teams[team]), team)
+		}
+	}
+}
+
+// collectApplication emits the metrics derived from the Application object alone.
+func (e *Exporter) collectApplication(ch chan<- prometheus.Metric, application appv1beta1.Application) {
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationOrphaned, prometheus.GaugeValue, boolFloat64(len(application.OwnerReferences) == 0), application.Namespace, e.applicationName(application))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationSpecHash, prometheus.GaugeValue, 1, application.Namespace, e.applicationName(application), specHash(application.Spec))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationAddOwnerRef, prometheus.GaugeValue, boolFloat64(application.Spec.AddOwnerRef), application.Namespace, e.applicationName(application))
+
+	var lastUpdate float64
+	hasReady := false
+	statuses := map[v1.ConditionStatus]int{}
+	for _, c := range application.Status.Conditions {
+		statuses[c.Status]++
+		if !c.LastUpdateTime.IsZero() && float64(c.LastUpdateTime.Unix()) > lastUpdate {
+			lastUpdate = float64(c.LastUpdateTime.Unix())
+		}
+		if c.Type == appv1beta1.Ready {
+			hasReady = true
+		}
+		if c.Type == appv1beta1.Error && c.Status == v1.ConditionTrue {
+			reason := c.Reason
+			if !e.reconcileErrorReasons[reason] {
+				reason = otherReconcileErrorReason
+			}
+			ch <- prometheus.MustNewConstMetric(e.KubeApplicationReconcileError, prometheus.GaugeValue, 1, application.Namespace, e.applicationName(application), reason)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationStatusLastUpdate, prometheus.GaugeValue, lastUpdate, application.Namespace, e.applicationName(application))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationMissingReady, prometheus.GaugeValue, boolFloat64(!hasReady), application.Namespace, e.applicationName(application))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationPhaseDuration, prometheus.GaugeValue, e.phaseDuration(application).Seconds(), application.Namespace, e.applicationName(application))
+	for _, status := range []v1.ConditionStatus{v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown} {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationConditions, prometheus.GaugeValue, float64(statuses[status]), application.Namespace, e.applicationName(application), string(status))
+	}
+}
+
+// phaseDuration returns how long the Application has been in its assembly
+// phase, from the last transition of the condition tracking the phase: Error
+// for Failed Applications, Ready otherwise. It is 0 without a transition time.
+func (e *Exporter) phaseDuration(application appv1beta1.Application) time.Duration {
+	conditionType := appv1beta1.ConditionType(appv1beta1.Ready)
+	if application.Spec.AssemblyPhase == appv1beta1.Failed {
+		conditionType = appv1beta1.Error
+	}
+	for _, c := range application.Status.Conditions {
+		if c.Type == conditionType && !c.LastTransitionTime.IsZero() {
+			return e.options.Clock.Since(c.LastTransitionTime.Time)
+		}
+	}
+	return 0
+}
+
+// specHash returns a short FNV hash of spec. Lists whose order carries no
+// meaning are sorted first so that reordering them does not change the hash.
+func specHash(spec appv1beta1.ApplicationSpec) string {
+	canonical := spec.DeepCopy()
+	sort.Slice(canonical.ComponentGroupKinds, func(i, j int) bool {
+		if canonical.ComponentGroupKinds[i].Group != canonical.ComponentGroupKinds[j].Group {
+			return canonical.ComponentGroupKinds[i].Group < canonical.ComponentGroupKinds[j].Group
+		}
+		return canonical.ComponentGroupKinds[i].Kind < canonical.ComponentGroupKinds[j].Kind
+	})
+	sort.Strings(canonical.Descriptor.Keywords)
+	if canonical.Selector != nil {
+		exprs := canonical.Selector.MatchExpressions
+		for i := range exprs {
+			sort.Strings(exprs[i].Values)
+		}
+		sort.Slice(exprs, func(i, j int) bool {
+			if exprs[i].Key != exprs[j].Key {
+				return exprs[i].Key < exprs[j].Key
+			}
+			if exprs[i].Operator != exprs[j].Operator {
+				return exprs[i].Operator < exprs[j].Operator
+			}
+			return strings.Join(exprs[i].Values, ",") < strings.Join(exprs[j].Values, ",")
+		})
+	}
+
+	// Marshalling a struct cannot fail, and map keys are emitted sorted.
+	b, _ := json.Marshal(canonical)
+	h := fnv.New32a()
+	_, _ = h.Write(b)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// collectPod emits the metrics of a single pod selected by the Application,
+// including kube_pod_owner with the namespaceLabels values only if ownerSeries
+// and not already emitted within the scrape.
+func (e *Exporter) collectPod(ch chan<- prometheus.Metric, cache *scrapeCache, application appv1beta1.Application, pod v1.Pod, ownerSeries bool, namespaceLabels []string) {
+	emitOwner := ownerSeries && !e.options.AggregateByWorkload && e.emitsOwner(pod)
+	ownerValueType := prometheus.CounterValue
+	if e.options.KubePodOwnerAsGauge {
+		ownerValueType = prometheus.GaugeValue
 	}
+	ownerKind, ownerName, isController := e.options.OwnerResolver.Resolve(pod, application)
+	for _, container := range pod.Spec.Containers {
+		if emitOwner {
+			if values := append([]string{container.Name, application.ObjectMeta.Namespace, strconv.FormatBool(isController), ownerKind, ownerName, pod.Name}, namespaceLabels...); cache.addPodOwner(values) {
+				ch <- prometheus.MustNewConstMetric(e.KubePodOwner, ownerValueType, 1, values...)
+			}
+		}
+
+		probes := []struct {
+			name  string
+			probe *v1.Probe
+		}{
+			{"liveness", container.LivenessProbe},
+			{"readiness", container.ReadinessProbe},
+			{"startup", container.StartupProbe},
+		}
+		for _, p := range probes {
+			ch <- prometheus.MustNewConstMetric(e.KubeApplicationContainerProbes, prometheus.GaugeValue, boolFloat64(p.probe != nil), application.Namespace, e.applicationName(application), pod.Name, container.Name, p.name)
+		}
+
+		secrets, configMaps := envSources(container)
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationContainerEnvSources, prometheus.GaugeValue, float64(secrets), application.Namespace, e.applicationName(application), pod.Name, container.Name, envSourceSecret)
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationContainerEnvSources, prometheus.GaugeValue, float64(configMaps), application.Namespace, e.applicationName(application), pod.Name, container.Name, envSourceConfigMap)
+	}
+
+	node := pod.Spec.NodeName
+	if node == "" {
+		node = unscheduledNode
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodNode, prometheus.GaugeValue, 1, application.Namespace, e.applicationName(application), pod.Name, node)
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodTolerations, prometheus.GaugeValue, float64(len(pod.Spec.Tolerations)), application.Namespace, e.applicationName(application), pod.Name)
+
+	pvcs := 0
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			pvcs++
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodPVCs, prometheus.GaugeValue, float64(pvcs), application.Namespace, e.applicationName(application), pod.Name)
+
+	if reason := podFailureReason(pod); reason != "" {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodFailureReason, prometheus.GaugeValue, 1, application.Namespace, e.applicationName(application), pod.Name, reason)
+	}
+
+	if main, ok := e.mainContainer(pod); ok {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationMainImage, prometheus.GaugeValue, 1, application.Namespace, e.applicationName(application), pod.Name, main.Name, main.Image)
+	}
+}
+
+// emitsOwner reports whether pod passes PodAnnotationFilter. Annotations are
+// compared directly, as their values need not be valid label values.
+func (e *Exporter) emitsOwner(pod v1.Pod) bool {
+	for key, value := range e.options.PodAnnotationFilter {
+		if actual, ok := pod.Annotations[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// podFailureReason returns why a Failed or Pending pod isn't running: the
+// pod's own reason, e.g. Evicted, else the first terminated or waiting reason
+// of its containers, e.g. OOMKilled. Reasons outside podFailureReasons are
+// reported as "other", and the waiting reasons of containers still starting
+// as none.
+func podFailureReason(pod v1.Pod) string {
+	if pod.Status.Phase != v1.PodFailed && pod.Status.Phase != v1.PodPending {
+		return ""
+	}
+	reason := pod.Status.Reason
+	if reason == "" {
+		reason = containerFailureReason(pod.Status.InitContainerStatuses)
+	}
+	if reason == "" {
+		reason = containerFailureReason(pod.Status.ContainerStatuses)
+	}
+	if reason != "" && !podFailureReasons[reason] {
+		reason = otherPodFailureReason
+	}
+	return reason
+}
+
+func containerFailureReason(statuses []v1.ContainerStatus) string {
+	for _, status := range statuses {
+		if terminated := status.State.Terminated; terminated != nil && terminated.Reason != "" && terminated.Reason != "Completed" {
+			return terminated.Reason
+		}
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "" && waiting.Reason != "ContainerCreating" && waiting.Reason != "PodInitializing" {
+			return waiting.Reason
+		}
+	}
+	return ""
+}
+
+// envSources counts the container's envFrom entries and env keyRefs by
+// Secret and ConfigMap.
+func envSources(container v1.Container) (secrets, configMaps int) {
+	for _, from := range container.EnvFrom {
+		if from.SecretRef != nil {
+			secrets++
+		}
+		if from.ConfigMapRef != nil {
+			configMaps++
+		}
+	}
+	for _, env := range container.Env {
+		if env.ValueFrom == nil {
+			continue
+		}
+		if env.ValueFrom.SecretKeyRef != nil {
+			secrets++
+		}
+		if env.ValueFrom.ConfigMapKeyRef != nil {
+			configMaps++
+		}
+	}
+	return secrets, configMaps
+}
+
+// mainContainer returns the container named by MainContainerAnnotation, or
+// the pod's first container.
+func (e *Exporter) mainContainer(pod v1.Pod) (v1.Container, bool) {
+	if len(pod.Spec.Containers) == 0 {
+		return v1.Container{}, false
+	}
+	if name, ok := pod.Annotations[e.options.MainContainerAnnotation]; ok && e.options.MainContainerAnnotation != "" {
+		for _, container := range pod.Spec.Containers {
+			if container.Name == name {
+				return container, true
+			}
+		}
+	}
+	return pod.Spec.Containers[0], true
+}
+
+// collectPodSummary emits the Application level aggregates over its selected
+// pods, including kube_application_workload only if ownerSeries.
+func (e *Exporter) collectPodSummary(ctx context.Context, ch chan<- prometheus.Metric, cache *scrapeCache, application appv1beta1.Application, pods []v1.Pod, ownerSeries bool) {
+	restartThreshold := e.options.RestartThreshold
+	if restartThreshold == 0 {
+		restartThreshold = defaultRestartThreshold
+	}
+
+	imagePods := map[string]int{}
+	priorityPods := map[string]int{}
+	workloads := map[workload]bool{}
+	workloadPods := map[workload]int{}
+	degraded := 0
+	defaultSA := 0
+	withoutLimits := 0
+	untrusted := 0
+	foreignOwned := 0
+	active := 0
+	privileged := 0
+	gates := map[readinessGate]int{}
+	for _, pod := range pods {
+		for _, gate := range pod.Spec.ReadinessGates {
+			gates[readinessGate{gate: string(gate.ConditionType), status: readinessGateStatus(pod, gate.ConditionType)}]++
+		}
+
+		owner := topLevelWorkload(pod)
+		workloads[owner] = true
+		if ownerSeries && e.options.AggregateByWorkload && e.emitsOwner(pod) {
+			workloadPods[owner]++
+		}
+
+		if sa := pod.Spec.ServiceAccountName; sa == "" || sa == defaultServiceAccount {
+			defaultSA++
+		}
+
+		if e.options.ActiveLabel != "" {
+			if isActive, err := strconv.ParseBool(pod.Labels[e.options.ActiveLabel]); err == nil && isActive {
+				active++
+			}
+		}
+
+		if runsPrivileged(pod) {
+			privileged++
+		}
+
+		if ownedByOtherApplication(pod.OwnerReferences, application) {
+			foreignOwned++
+		}
+
+		if len(e.trustedRegistries) > 0 && !e.trustedImages(pod) {
+			untrusted++
+		}
+
+		for _, container := range pod.Spec.Containers {
+			_, cpu := container.Resources.Limits[v1.ResourceCPU]
+			_, memory := container.Resources.Limits[v1.ResourceMemory]
+			if !cpu || !memory {
+				withoutLimits++
+				break
+			}
+		}
+
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.RestartCount > restartThreshold {
+				degraded++
+				break
+			}
+		}
+
+		priorityClass := pod.Spec.PriorityClassName
+		if priorityClass == "" {
+			priorityClass = noPriorityClass
+		}
+		priorityPods[priorityClass]++
+
+		images := map[string]bool{}
+		for _, container := range pod.Spec.Containers {
+			images[container.Image] = true
+		}
+		for image := range images {
+			imagePods[image]++
+		}
+	}
+	for _, image := range e.countKeys(imagePods) {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationImagePodCount, prometheus.GaugeValue, float64(imagePods[image]), application.Namespace, e.applicationName(application), image)
+	}
+	for _, priorityClass := range e.countKeys(priorityPods) {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodsByPriority, prometheus.GaugeValue, float64(priorityPods[priorityClass]), application.Namespace, e.applicationName(application), priorityClass)
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationDegradedPods, prometheus.GaugeValue, float64(degraded), application.Namespace, e.applicationName(application))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationWorkloads, prometheus.GaugeValue, float64(len(workloads)), application.Namespace, e.applicationName(application))
+	owners := make([]workload, 0, len(workloadPods))
+	for owner := range workloadPods {
+		owners = append(owners, owner)
+	}
+	if e.options.DeterministicOrder {
+		sort.Slice(owners, func(i, j int) bool {
+			if owners[i].kind != owners[j].kind {
+				return owners[i].kind < owners[j].kind
+			}
+			return owners[i].name < owners[j].name
+		})
+	}
+	for _, owner := range owners {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationWorkload, prometheus.GaugeValue, float64(workloadPods[owner]), application.Namespace, e.applicationName(application), owner.kind, owner.name)
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodsDefaultSA, prometheus.GaugeValue, float64(defaultSA), application.Namespace, e.applicationName(application))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodsWithoutLimits, prometheus.GaugeValue, float64(withoutLimits), application.Namespace, e.applicationName(application))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationForeignOwnedPods, prometheus.GaugeValue, float64(foreignOwned), application.Namespace, e.applicationName(application))
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationPrivilegedContainers, prometheus.GaugeValue, float64(privileged), application.Namespace, e.applicationName(application))
+	gateStatuses := make([]readinessGate, 0, len(gates))
+	for gate := range gates {
+		gateStatuses = append(gateStatuses, gate)
+	}
+	if e.options.DeterministicOrder {
+		sort.Slice(gateStatuses, func(i, j int) bool {
+			if gateStatuses[i].gate != gateStatuses[j].gate {
+				return gateStatuses[i].gate < gateStatuses[j].gate
+			}
+			return gateStatuses[i].status < gateStatuses[j].status
+		})
+	}
+	for _, gate := range gateStatuses {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationPodsReadinessGates, prometheus.GaugeValue, float64(gates[gate]), application.Namespace, e.applicationName(application), gate.gate, gate.status)
+	}
+	if e.options.ActiveLabel != "" {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationActivePods, prometheus.GaugeValue, float64(active), application.Namespace, e.applicationName(application))
+	}
+	if len(e.trustedRegistries) > 0 {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationUntrustedImages, prometheus.GaugeValue, float64(untrusted), application.Namespace, e.applicationName(application))
+	}
+
+	delta := e.matchedPodsDelta(types.NamespacedName{Namespace: application.Namespace, Name: application.Name}, len(pods), !cache.oneOff)
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationMatchedPodsDelta, prometheus.GaugeValue, float64(delta), application.Namespace, e.applicationName(application))
+
+	if e.options.CollectZones {
+		if nodeZones, err := e.nodeZones(ctx, cache); err == nil {
+			zones := map[string]bool{}
+			for _, pod := range pods {
+				if zone, ok := nodeZones[pod.Spec.NodeName]; ok && zone != "" {
+					zones[zone] = true
+				}
+			}
+			ch <- prometheus.MustNewConstMetric(e.KubeApplicationZones, prometheus.GaugeValue, float64(len(zones)), application.Namespace, e.applicationName(application))
+		}
+	}
+}
+
+// recordPods remembers the pods selected by the Application labelled name.
+func (c *scrapeCache) recordPods(namespace, name string, pods []v1.Pod) {
+	if c.podSets == nil {
+		c.podSets = map[string]map[string]map[string]bool{}
+	}
+	apps := c.podSets[namespace]
+	if apps == nil {
+		apps = map[string]map[string]bool{}
+		c.podSets[namespace] = apps
+	}
+	names := map[string]bool{}
+	for _, pod := range pods {
+		names[pod.Name] = true
+	}
+	apps[name] = names
+}
+
+// addPodOwner records the kube_pod_owner label values, reporting false if
+// they were already recorded.
+func (c *scrapeCache) addPodOwner(values []string) bool {
+	key := strings.Join(values, "\x00")
+	if c.podOwners[key] {
+		return false
+	}
+	if c.podOwners == nil {
+		c.podOwners = map[string]bool{}
+	}
+	c.podOwners[key] = true
+	return true
+}
+
+// collectSelectorOverlap emits, for every pair of Applications in a namespace
+// selecting a common pod, the overlap in both directions.
+func (e *Exporter) collectSelectorOverlap(ch chan<- prometheus.Metric, cache *scrapeCache) {
+	namespaces := make([]string, 0, len(cache.podSets))
+	for namespace := range cache.podSets {
+		namespaces = append(namespaces, namespace)
+	}
+	if e.options.DeterministicOrder {
+		sort.Strings(namespaces)
+	}
+	for _, namespace := range namespaces {
+		apps := cache.podSets[namespace]
+		names := make([]string, 0, len(apps))
+		for name := range apps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for i, name := range names {
+			for _, other := range names[i+1:] {
+				if !intersects(apps[name], apps[other]) {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(e.KubeApplicationSelectorOverlap, prometheus.GaugeValue, 1, namespace, name, other)
+				ch <- prometheus.MustNewConstMetric(e.KubeApplicationSelectorOverlap, prometheus.GaugeValue, 1, namespace, other, name)
+			}
+		}
+	}
+}
+
+func intersects(a, b map[string]bool) bool {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	for k := range a {
+		if b[k] {
+			return true
+		}
+	}
+	return false
+}
+
+type readinessGate struct {
+	gate, status string
+}
+
+// readinessGateStatus returns the status of the pod's condition for a
+// readiness gate, which like the kubelet defaults to False when missing.
+func readinessGateStatus(pod v1.Pod, conditionType v1.PodConditionType) string {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == conditionType {
+			return string(c.Status)
+		}
+	}
+	return string(v1.ConditionFalse)
+}
+
+// runsPrivileged reports whether any container of pod, including its init
+// containers, is privileged or runs as UID 0, falling back to the pod's
+// RunAsUser for containers that don't set one.
+func runsPrivileged(pod v1.Pod) bool {
+	var podRunAsUser *int64
+	if pod.Spec.SecurityContext != nil {
+		podRunAsUser = pod.Spec.SecurityContext.RunAsUser
+	}
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			runAsUser := podRunAsUser
+			if sc := container.SecurityContext; sc != nil {
+				if sc.Privileged != nil && *sc.Privileged {
+					return true
+				}
+				if sc.RunAsUser != nil {
+					runAsUser = sc.RunAsUser
+				}
+			}
+			if runAsUser != nil && *runAsUser == 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trustedImages reports whether all container images of pod, including its
+// init containers, come from TrustedRegistries.
+func (e *Exporter) trustedImages(pod v1.Pod) bool {
+	for _, containers := range [][]v1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if !e.trustedRegistries[imageRegistry(container.Image)] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// imageRegistry returns the registry host of an image reference. Like docker,
+// the first path component is only taken as the host if it contains a "." or
+// ":" or is "localhost"; other images are pulled from docker.io.
+func imageRegistry(image string) string {
+	i := strings.IndexRune(image, '/')
+	if i < 0 {
+		return defaultRegistry
+	}
+	host := image[:i]
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		return defaultRegistry
+	}
+	if host == "index.docker.io" {
+		return defaultRegistry
+	}
+	return host
+}
+
+// matchedPodsDelta returns the difference of count to the previous scrape of
+// key, recording count if record is set. The first scrape reports 0.
+func (e *Exporter) matchedPodsDelta(key types.NamespacedName, count int, record bool) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	previous, ok := e.matchedPods[key]
+	if record {
+		e.matchedPods[key] = count
+	}
+	if !ok {
+		return 0
+	}
+	return count - previous
+}
+
+// pruneApplications forgets the Applications that are no longer collected.
+func (e *Exporter) pruneApplications(apps []appv1beta1.Application) {
+	current := make(map[types.NamespacedName]bool, len(apps))
+	for _, app := range apps {
+		current[types.NamespacedName{Namespace: app.Namespace, Name: app.Name}] = true
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for key := range e.matchedPods {
+		if !current[key] {
+			delete(e.matchedPods, key)
+		}
+	}
+	for key, name := range e.latencyNames {
+		if !current[key] {
+			e.scrapeLatency.DeleteLabelValues(key.Namespace, name)
+			delete(e.latencyNames, key)
+		}
+	}
+}
+
+// observeScrapeLatency records how long collecting the Application took,
+// dropping its series under a previous application label.
+func (e *Exporter) observeScrapeLatency(application appv1beta1.Application, latency time.Duration) {
+	key := types.NamespacedName{Namespace: application.Namespace, Name: application.Name}
+	name := e.applicationName(application)
+	e.mu.Lock()
+	if previous, ok := e.latencyNames[key]; ok && previous != name {
+		e.scrapeLatency.DeleteLabelValues(application.Namespace, previous)
+	}
+	e.latencyNames[key] = name
+	e.mu.Unlock()
+	e.scrapeLatency.WithLabelValues(application.Namespace, name).Observe(latency.Seconds())
+}
+
+// applicationName returns the application label value of the Application:
+// its descriptor displayName with UseDisplayName, if set and it did not clash
+// in the last scrape, else its name.
+func (e *Exporter) applicationName(application appv1beta1.Application) string {
+	if !e.options.UseDisplayName {
+		return application.Name
+	}
+	e.mu.Lock()
+	clash := e.displayNameClashes[types.NamespacedName{Namespace: application.Namespace, Name: application.Name}]
+	e.mu.Unlock()
+	if clash {
+		return application.Name
+	}
+	return applicationName(application, true)
+}
+
+// setDisplayNameClashes records the Applications whose displayName equals the
+// displayName or name of another Application in the same namespace.
+func (e *Exporter) setDisplayNameClashes(apps []appv1beta1.Application) {
+	type label struct{ namespace, value string }
+	uses := map[label]int{}
+	for _, application := range apps {
+		uses[label{application.Namespace, application.Name}]++
+		if displayName := application.Spec.Descriptor.DisplayName; displayName != "" && displayName != application.Name {
+			uses[label{application.Namespace, displayName}]++
+		}
+	}
+
+	clashes := map[types.NamespacedName]bool{}
+	for _, application := range apps {
+		if displayName := application.Spec.Descriptor.DisplayName; displayName != "" && uses[label{application.Namespace, displayName}] > 1 {
+			clashes[types.NamespacedName{Namespace: application.Namespace, Name: application.Name}] = true
+		}
+	}
+	e.mu.Lock()
+	e.displayNameClashes = clashes
+	e.mu.Unlock()
+}
+
+func applicationName(application appv1beta1.Application, useDisplayName bool) string {
+	if useDisplayName && application.Spec.Descriptor.DisplayName != "" {
+		return application.Spec.Descriptor.DisplayName
+	}
+	return application.Name
+}
+
+// nodeZones lists the cluster's Nodes on first use within a scrape and maps
+// each to its topology zone. A failed List is not retried within the scrape.
+func (e *Exporter) nodeZones(ctx context.Context, cache *scrapeCache) (map[string]string, error) {
+	if cache.nodeZones != nil || cache.nodeZonesErr != nil {
+		return cache.nodeZones, cache.nodeZonesErr
+	}
+	nodeList := &v1.NodeList{}
+	if err := e.options.Client.List(ctx, nodeList); err != nil {
+		getLoggerOrDie(ctx).Error(err, "unable to list Nodes")
+		cache.nodeZonesErr = err
+		return nil, err
+	}
+	cache.nodeZones = map[string]string{}
+	for _, node := range nodeList.Items {
+		zone, ok := node.Labels[v1.LabelZoneFailureDomainStable]
+		if !ok {
+			zone = node.Labels[v1.LabelZoneFailureDomain]
+		}
+		cache.nodeZones[node.Name] = zone
+	}
+	return cache.nodeZones, nil
+}
+
+// namespaceLabelValues returns the NamespaceLabels values of namespace, empty
+// if the Namespace can't be fetched.
+func (e *Exporter) namespaceLabelValues(ctx context.Context, cache *scrapeCache, namespace string) []string {
+	if len(e.options.NamespaceLabels) == 0 {
+		return nil
+	}
+	if values, ok := cache.namespaceLabels[namespace]; ok {
+		return values
+	}
+
+	values := make([]string, len(e.options.NamespaceLabels))
+	ns := &v1.Namespace{}
+	if err := e.options.Client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		getLoggerOrDie(ctx).Error(err, "unable to get Namespace", "namespace", namespace)
+	} else {
+		for i, key := range e.options.NamespaceLabels {
+			values[i] = ns.Labels[key]
+		}
+	}
+	if cache.namespaceLabels == nil {
+		cache.namespaceLabels = map[string][]string{}
+	}
+	cache.namespaceLabels[namespace] = values
+	return values
+}
+
+// namespaceLabelNames returns the kube_pod_owner label names of the
+// NamespaceLabels keys, with characters invalid in label names replaced.
+func namespaceLabelNames(keys []string) []string {
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, "ns_label_"+strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+				return r
+			}
+			return '_'
+		}, key))
+	}
+	return names
+}
+
+// collectJobs emits the completion status of the Jobs selected by the
+// Application, including those created by its CronJobs.
+func (e *Exporter) collectJobs(ctx context.Context, ch chan<- prometheus.Metric, application appv1beta1.Application) {
+	if application.Spec.Selector == nil {
+		return
+	}
+	jobList := &batchv1.JobList{}
+	if err := e.options.Client.List(ctx, jobList, &client.ListOptions{
+		Namespace:     application.Namespace,
+		LabelSelector: labels.SelectorFromSet(application.Spec.Selector.MatchLabels),
+	}); err != nil {
+		getLoggerOrDie(ctx).Error(err, "unable to list Jobs", "application", application.Namespace+"/"+application.Name)
+		return
+	}
+	for _, job := range jobList.Items {
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationJobCompletion, prometheus.GaugeValue, 1, application.Namespace, e.applicationName(application), job.Name, jobStatus(job))
+	}
+}
+
+// jobStatus returns complete or failed for a finished Job, else active.
+func jobStatus(job batchv1.Job) string {
+	for _, c := range job.Status.Conditions {
+		if c.Status != v1.ConditionTrue {
+			continue
+		}
+		switch c.Type {
+		case batchv1.JobComplete:
+			return jobComplete
+		case batchv1.JobFailed:
+			return jobFailed
+		}
+	}
+	return jobActive
+}
+
+func (e *Exporter) collectServices(ctx context.Context, ch chan<- prometheus.Metric, application appv1beta1.Application) {
+	if application.Spec.Selector == nil {
+		return
+	}
+	serviceList := &v1.ServiceList{}
+	if err := e.options.Client.List(ctx, serviceList, &client.ListOptions{
+		Namespace:     application.Namespace,
+		LabelSelector: labels.SelectorFromSet(application.Spec.Selector.MatchLabels),
+	}); err != nil {
+		getLoggerOrDie(ctx).Error(err, "unable to list Services", "application", application.Namespace+"/"+application.Name)
+		return
+	}
+	for _, service := range serviceList.Items {
+		serviceType := service.Spec.Type
+		if serviceType == "" {
+			serviceType = v1.ServiceTypeClusterIP
+		}
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationServiceType, prometheus.GaugeValue, 1, application.Namespace, e.applicationName(application), service.Name, string(serviceType))
+	}
+}
+
+func (e *Exporter) collectComponentPresence(ctx context.Context, ch chan<- prometheus.Metric, application appv1beta1.Application) {
+	for _, gk := range application.Spec.ComponentGroupKinds {
+		components, ok := e.listComponents(ctx, application, gk)
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationComponentPresent, prometheus.GaugeValue, boolFloat64(len(components) > 0), application.Namespace, e.applicationName(application), gk.Group, gk.Kind)
+	}
+}
+
+// CheckManageable sends an empty server-side apply patch of the Application as
+// a dry run, which fails if the client can't write it, e.g. for missing RBAC.
+func (e *Exporter) CheckManageable(ctx context.Context, application appv1beta1.Application) error {
+	patch := &unstructured.Unstructured{}
+	patch.SetGroupVersionKind(appv1beta1.GroupVersion.WithKind(appv1beta1.ResourceKindApplication))
+	patch.SetNamespace(application.Namespace)
+	patch.SetName(application.Name)
+	return e.options.Client.Patch(ctx, patch, client.Apply, client.DryRunAll, client.FieldOwner(manageableFieldManager))
+}
+
+// collectBrokenLinks checks every descriptor link of the Application with a
+// HEAD request, which fails on errors and error statuses.
+func (e *Exporter) collectBrokenLinks(ctx context.Context, ch chan<- prometheus.Metric, application appv1beta1.Application) {
+	timeout := e.options.DescriptorLinkTimeout
+	if timeout <= 0 {
+		timeout = defaultDescriptorLinkTimeout
+	}
+	httpClient := &http.Client{Timeout: timeout}
+	checked := map[string]bool{}
+	for _, link := range application.Spec.Descriptor.Links {
+		if link.URL == "" || checked[link.URL] {
+			continue
+		}
+		checked[link.URL] = true
+		broken := true
+		if req, err := http.NewRequestWithContext(ctx, http.MethodHead, link.URL, nil); err == nil {
+			if resp, err := httpClient.Do(req); err == nil {
+				resp.Body.Close()
+				broken = resp.StatusCode >= http.StatusBadRequest
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(e.KubeApplicationBrokenLinks, prometheus.GaugeValue, boolFloat64(broken), application.Namespace, e.applicationName(application), link.URL)
+	}
+}
+
+// collectComponentKindMismatch compares the declared component kinds with the
+// kinds actually selected: the declared kinds with at least one match, plus
+// the top-level workload kinds owning the selected pods. Kinds are compared
+// without their group.
+func (e *Exporter) collectComponentKindMismatch(ctx context.Context, ch chan<- prometheus.Metric, application appv1beta1.Application, pods []v1.Pod) {
+	declared := map[string]bool{}
+	actual := map[string]bool{}
+	for _, gk := range application.Spec.ComponentGroupKinds {
+		declared[gk.Kind] = true
+		components, ok := e.listComponents(ctx, application, gk)
+		if !ok {
+			// The selected kinds are unknown, so don't guess at a mismatch.
+			return
+		}
+		if len(components) > 0 {
+			actual[gk.Kind] = true
+		}
+	}
+	for _, pod := range pods {
+		actual[topLevelWorkload(pod).kind] = true
+	}
+
+	mismatch := len(declared) != len(actual)
+	for kind := range actual {
+		if !declared[kind] {
+			mismatch = true
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationComponentKindMismatch, prometheus.GaugeValue, boolFloat64(mismatch), application.Namespace, e.applicationName(application))
+}
+
+// collectMissingOwnerRefs counts the components of an Application with
+// Spec.AddOwnerRef that the controller hasn't yet made owned by it.
+func (e *Exporter) collectMissingOwnerRefs(ctx context.Context, ch chan<- prometheus.Metric, application appv1beta1.Application) {
+	missing := 0
+	for _, gk := range application.Spec.ComponentGroupKinds {
+		components, ok := e.listComponents(ctx, application, gk)
+		if !ok {
+			continue
+		}
+		for _, component := range components {
+			if !ownedByApplication(component.GetOwnerReferences(), application) {
+				missing++
+			}
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(e.KubeApplicationComponentsMissingOwnerRef, prometheus.GaugeValue, float64(missing), application.Namespace, e.applicationName(application))
+}
+
+// listComponents lists the objects of kind gk selected by the Application,
+// none without a selector. Unmappable kinds and list failures are logged and
+// reported as not ok.
+func (e *Exporter) listComponents(ctx context.Context, application appv1beta1.Application, gk metav1.GroupKind) ([]unstructured.Unstructured, bool) {
+	if application.Spec.Selector == nil {
+		return nil, true
+	}
+	logger := getLoggerOrDie(ctx)
+	mapping, err := e.options.Mapper.RESTMapping(schema.GroupKind{
+		Group: appv1beta1.StripVersion(gk.Group),
+		Kind:  gk.Kind,
+	})
+	if err != nil {
+		logger.Info("NoMappingForGK", "gk", gk.String())
+		return nil, false
+	}
+
+	list := &unstructured.UnstructuredList{}
+	list.SetGroupVersionKind(mapping.GroupVersionKind.GroupVersion().WithKind(mapping.GroupVersionKind.Kind + "List"))
+	if err := e.options.Client.List(ctx, list, &client.ListOptions{
+		Namespace:     application.Namespace,
+		LabelSelector: labels.SelectorFromSet(application.Spec.Selector.MatchLabels),
+	}); err != nil {
+		logger.Error(err, "unable to list resources for GVK", "gvk", mapping.GroupVersionKind)
+		return nil, false
+	}
+	return list.Items, true
+}
+
+// ownedByApplication mirrors how the controller matches the owner references
+// it sets for Spec.AddOwnerRef.
+func ownedByApplication(refs []metav1.OwnerReference, application appv1beta1.Application) bool {
+	for _, ref := range refs {
+		if ref.Kind == appv1beta1.ResourceKindApplication && ref.APIVersion == appv1beta1.GroupVersion.String() && ref.Name == application.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// ownedByOtherApplication reports whether refs include an Application, of any
+// version, other than application.
+func ownedByOtherApplication(refs []metav1.OwnerReference, application appv1beta1.Application) bool {
+	for _, ref := range refs {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil || gv.Group != appv1beta1.GroupVersion.Group || ref.Kind != appv1beta1.ResourceKindApplication {
+			continue
+		}
+		if ref.Name != application.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Exporter) registerExporterLastScrapeError(ctx context.Context, ch chan<- prometheus.Metric, val float64, valType prometheus.ValueType, labelValues ...string) {
+	logging := getLoggerOrDie(ctx)
+	if m, err := prometheus.NewConstMetric(e.ExporterLastScrapeError, valType, val, labelValues...); err == nil {
+		ch <- m
+	} else {
+		logging.Error(err, "unable to register exporter last scrape error")
+	}
+}
+
+// workload identifies the top-level owner of a pod.
+type workload struct {
+	kind, name string
+}
+
+// topLevelWorkload derives the top-level owner of pod from its controller
+// reference without further lookups: a ReplicaSet created by a Deployment is
+// recognised by the pod-template-hash suffix of its name, and a pod without
+// controller is its own workload.
+func topLevelWorkload(pod v1.Pod) workload {
+	ref := metav1.GetControllerOf(&pod)
+	if ref == nil {
+		return workload{kind: "Pod", name: pod.Name}
+	}
+	if ref.Kind == "ReplicaSet" {
+		if hash, ok := pod.Labels["pod-template-hash"]; ok && strings.HasSuffix(ref.Name, "-"+hash) {
+			return workload{kind: "Deployment", name: strings.TrimSuffix(ref.Name, "-"+hash)}
+		}
+	}
+	return workload{kind: ref.Kind, name: ref.Name}
+}
+
+func boolFloat64(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func sortApplications(apps []appv1beta1.Application) {
+	sort.Slice(apps, func(i, j int) bool {
+		if apps[i].Namespace != apps[j].Namespace {
+			return apps[i].Namespace < apps[j].Namespace
+		}
+		return apps[i].Name < apps[j].Name
+	})
+}
+
+// countKeys returns the keys of counts, sorted with DeterministicOrder.
+func (e *Exporter) countKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	if e.options.DeterministicOrder {
+		sort.Strings(keys)
+	}
+	return keys
+}
+
+func sortPods(pods []v1.Pod) {
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Name < pods[j].Name
+	})
 }
 
 func getLoggerOrDie(ctx context.Context) logr.Logger {
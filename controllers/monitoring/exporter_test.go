@@ -0,0 +1,1819 @@
+package monitoring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/clock"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	appv1beta1 "sigs.k8s.io/application/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func init() {
+	_ = appv1beta1.AddToScheme(scheme.Scheme)
+}
+
+// listErrorClient fails every List call with err.
+type listErrorClient struct {
+	client.Client
+	err error
+}
+
+func (c listErrorClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	return c.err
+}
+
+// errorCountingLogger counts the errors logged through it and its children.
+type errorCountingLogger struct {
+	logf.NullLogger
+	errors *int
+}
+
+func (l errorCountingLogger) Error(err error, msg string, keysAndValues ...interface{}) {
+	*l.errors++
+}
+
+func (l errorCountingLogger) WithValues(keysAndValues ...interface{}) logr.Logger {
+	return l
+}
+
+func (l errorCountingLogger) WithName(name string) logr.Logger {
+	return l
+}
+
+// pagedClient serves ApplicationLists in pages of the requested Limit, with
+// the page offset as continue token, and expires the first expireAfter
+// continue tokens it is handed.
+type pagedClient struct {
+	client.Client
+	apps        []appv1beta1.Application
+	expireAfter int
+	calls       int
+}
+
+func (c *pagedClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	appList, ok := list.(*appv1beta1.ApplicationList)
+	if !ok {
+		return c.Client.List(ctx, list, opts...)
+	}
+	c.calls++
+	listOpts := &client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+
+	start := 0
+	if listOpts.Continue != "" {
+		if c.expireAfter > 0 {
+			c.expireAfter--
+			return apierrors.NewResourceExpired("continue token expired")
+		}
+		start, _ = strconv.Atoi(listOpts.Continue)
+	}
+	end := start + int(listOpts.Limit)
+	if end >= len(c.apps) {
+		end = len(c.apps)
+	} else {
+		appList.Continue = strconv.Itoa(end)
+	}
+	appList.Items = append([]appv1beta1.Application(nil), c.apps[start:end]...)
+	return nil
+}
+
+func newTestExporter(g *gomega.WithT, opts Options, objs ...runtime.Object) *Exporter {
+	if opts.Log == nil {
+		opts.Log = logf.NullLogger{}
+	}
+	if opts.Client == nil {
+		opts.Client = fake.NewFakeClientWithScheme(scheme.Scheme, objs...)
+	}
+	e, err := NewAppExporter(opts)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	return e
+}
+
+func gatherFamilies(g *gomega.WithT, e *Exporter) map[string]*dto.MetricFamily {
+	registry := prometheus.NewPedanticRegistry()
+	g.Expect(registry.Register(e)).To(gomega.Succeed())
+	families, err := registry.Gather()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	byName := map[string]*dto.MetricFamily{}
+	for _, mf := range families {
+		byName[mf.GetName()] = mf
+	}
+	return byName
+}
+
+// collectInOrder drains a single Collect call and renders each metric named
+// name as its label pairs, preserving emission order.
+func collectInOrder(g *gomega.WithT, e *Exporter, name string) []string {
+	return collectInOrderExcept(g, e, func(fqName string) bool { return fqName != name })
+}
+
+// collectInOrderExcept is collectInOrder for all metrics not skipped.
+func collectInOrderExcept(g *gomega.WithT, e *Exporter, skip func(fqName string) bool) []string {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		e.Collect(ch)
+		close(ch)
+	}()
+
+	var out []string
+	for m := range ch {
+		desc := m.Desc().String()
+		fqName := desc[strings.Index(desc, `fqName: "`)+len(`fqName: "`):]
+		fqName = fqName[:strings.Index(fqName, `"`)]
+		if skip(fqName) {
+			continue
+		}
+		pb := &dto.Metric{}
+		g.Expect(m.Write(pb)).To(gomega.Succeed())
+		out = append(out, fqName+" "+pb.String())
+	}
+	return out
+}
+
+// findMetric returns the first metric of mf carrying all of the given label values.
+func findMetric(mf *dto.MetricFamily, lbls map[string]string) *dto.Metric {
+	if mf == nil {
+		return nil
+	}
+	for _, m := range mf.GetMetric() {
+		matched := 0
+		for _, lp := range m.GetLabel() {
+			if v, ok := lbls[lp.GetName()]; ok && v == lp.GetValue() {
+				matched++
+			}
+		}
+		if matched == len(lbls) {
+			return m
+		}
+	}
+	return nil
+}
+
+func newApplication(namespace, name string, matchLabels map[string]string) *appv1beta1.Application {
+	return &appv1beta1.Application{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec: appv1beta1.ApplicationSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: matchLabels},
+		},
+	}
+}
+
+func newPod(namespace, name string, lbls map[string]string, containers ...string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, Labels: lbls},
+	}
+	for _, c := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: c, Image: c + ":latest"})
+	}
+	return pod
+}
+
+func TestKubePodOwner(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		newPod("default", "web-0", lbls, "nginx", "sidecar"),
+		newPod("default", "other", map[string]string{"app": "other"}, "nginx"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "container": "sidecar", "owner_name": "web", "owner_kind": "Application"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "other"})).To(gomega.BeNil())
+}
+
+func TestComponentPresence(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{appsv1.SchemeGroupVersion, v1.SchemeGroupVersion})
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(v1.SchemeGroupVersion.WithKind("Service"), meta.RESTScopeNamespace)
+
+	app := newApplication("default", "web", lbls)
+	app.Spec.ComponentGroupKinds = []metav1.GroupKind{
+		{Group: "apps", Kind: "Deployment"},
+		{Group: "", Kind: "Service"},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Labels: lbls},
+	}
+	e := newTestExporter(g, Options{Mapper: mapper, CheckComponentPresence: true}, app, deployment)
+
+	mf := gatherFamilies(g, e)["kube_application_component_present"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "group": "apps", "kind": "Deployment"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "group": "", "kind": "Service"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+}
+
+func TestApplicationWithoutSelector(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{appsv1.SchemeGroupVersion})
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+
+	app := newApplication("default", "web", lbls)
+	app.Spec.Selector = nil
+	app.Spec.AddOwnerRef = true
+	app.Spec.ComponentGroupKinds = []metav1.GroupKind{{Group: "apps", Kind: "Deployment"}}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Labels: lbls},
+	}
+	e := newTestExporter(g, Options{Mapper: mapper, CheckComponentPresence: true, CheckComponentKindMismatch: true},
+		app, deployment, newPod("default", "web-0", lbls, "nginx"))
+
+	families := gatherFamilies(g, e)
+	g.Expect(families).NotTo(gomega.HaveKey("kube_pod_owner"))
+	g.Expect(families["kube_application_component_present"].GetMetric()[0].GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(families["kube_application_components_missing_owner_ref"].GetMetric()[0].GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(families["exporter_last_scrape_error"].GetMetric()[0].GetGauge().GetValue()).To(gomega.Equal(0.0))
+}
+
+func TestComponentPresenceRequiresMapper(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	_, err := NewAppExporter(Options{CheckComponentPresence: true})
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("Mapper")))
+	_, err = NewAppExporter(Options{CheckComponentKindMismatch: true})
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("Mapper")))
+}
+
+func TestComponentPresenceDisabled(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	app := newApplication("default", "web", map[string]string{"app": "web"})
+	app.Spec.ComponentGroupKinds = []metav1.GroupKind{{Group: "", Kind: "Service"}}
+	e := newTestExporter(g, Options{}, app)
+
+	g.Expect(gatherFamilies(g, e)).NotTo(gomega.HaveKey("kube_application_component_present"))
+}
+
+func TestDeterministicOrder(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	var objs []runtime.Object
+	for _, ns := range []string{"ns-b", "ns-a", "ns-c"} {
+		for _, name := range []string{"web-2", "web-1", "web-3"} {
+			objs = append(objs, newApplication(ns, name, lbls))
+			objs = append(objs, newPod(ns, name+"-pod", lbls, "nginx"))
+		}
+	}
+	e := newTestExporter(g, Options{DeterministicOrder: true}, objs...)
+
+	first := collectInOrder(g, e, "kube_pod_owner")
+	g.Expect(first).To(gomega.HaveLen(27))
+	for i := 0; i < 5; i++ {
+		g.Expect(collectInOrder(g, e, "kube_pod_owner")).To(gomega.Equal(first))
+	}
+	g.Expect(first[0]).To(gomega.ContainSubstring(`value:"ns-a"`))
+	g.Expect(first[0]).To(gomega.ContainSubstring(`value:"web-1"`))
+	g.Expect(first[len(first)-1]).To(gomega.ContainSubstring(`value:"ns-c"`))
+	g.Expect(first[len(first)-1]).To(gomega.ContainSubstring(`value:"web-3"`))
+
+	// The whole output, with metrics ranging over per-Application maps.
+	objs = nil
+	for _, ns := range []string{"ns-b", "ns-a", "ns-c"} {
+		for _, name := range []string{"web-2", "web-1", "web-3"} {
+			app := newApplication(ns, name, lbls)
+			app.Annotations = map[string]string{"team": name}
+			objs = append(objs, app)
+
+			pod := ownedPod(ns, name+"-pod", lbls, name, "abc")
+			pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Name: "sidecar", Image: name + ":latest"})
+			pod.Spec.PriorityClassName = name
+			pod.Spec.ReadinessGates = []v1.PodReadinessGate{{ConditionType: "gate-b"}, {ConditionType: "gate-a"}}
+			objs = append(objs, pod)
+		}
+	}
+	// Latencies differ between scrapes.
+	skip := func(fqName string) bool { return fqName == "kube_application_scrape_duration_seconds" }
+
+	for _, opts := range []Options{
+		{DeterministicOrder: true, TeamAnnotation: "team", DetectSelectorOverlap: true},
+		{DeterministicOrder: true, AggregateByWorkload: true},
+	} {
+		e := newTestExporter(g, opts, objs...)
+		first = collectInOrderExcept(g, e, skip)
+		for i := 0; i < 20; i++ {
+			g.Expect(collectInOrderExcept(g, e, skip)).To(gomega.Equal(first))
+		}
+	}
+}
+
+func TestPodNode(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	pod0 := newPod("default", "web-0", lbls, "nginx")
+	pod0.Spec.NodeName = "node-a"
+	pod1 := newPod("default", "web-1", lbls, "nginx")
+	pod1.Spec.NodeName = "node-b"
+	pod2 := newPod("default", "web-2", lbls, "nginx")
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls), pod0, pod1, pod2)
+
+	mf := gatherFamilies(g, e)["kube_application_pod_node"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "pod": "web-0", "node": "node-a"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "pod": "web-1", "node": "node-b"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "pod": "web-2", "node": "unscheduled"})).NotTo(gomega.BeNil())
+}
+
+func TestClientConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	config := rest.Config{Host: "https://127.0.0.1:6443", QPS: 5, Burst: 10}
+
+	cfg := clientConfig(config, Options{ClientQPS: 50, ClientBurst: 100})
+	g.Expect(cfg.QPS).To(gomega.Equal(float32(50)))
+	g.Expect(cfg.Burst).To(gomega.Equal(100))
+	g.Expect(config.QPS).To(gomega.Equal(float32(5)))
+
+	cfg = clientConfig(config, Options{})
+	g.Expect(cfg.QPS).To(gomega.Equal(float32(5)))
+	g.Expect(cfg.Burst).To(gomega.Equal(10))
+}
+
+func TestNewAppExporterFromConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	e, err := NewAppExporterFromConfig(rest.Config{Host: "https://127.0.0.1:6443"}, Options{
+		Log:         logf.NullLogger{},
+		ClientQPS:   50,
+		ClientBurst: 100,
+	})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(e.options.Client).NotTo(gomega.BeNil())
+	g.Expect(e.options.Mapper).NotTo(gomega.BeNil())
+
+	injected := fake.NewFakeClientWithScheme(scheme.Scheme)
+	e, err = NewAppExporterFromConfig(rest.Config{}, Options{Log: logf.NullLogger{}, Client: injected, ClientQPS: 50})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(e.options.Client).To(gomega.BeIdenticalTo(injected))
+}
+
+func TestOrphaned(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	owned := newApplication("default", "owned", map[string]string{"app": "owned"})
+	owned.OwnerReferences = []metav1.OwnerReference{{APIVersion: "example.com/v1", Kind: "Operator", Name: "op", UID: "1234"}}
+	orphan := newApplication("default", "orphan", map[string]string{"app": "orphan"})
+	e := newTestExporter(g, Options{}, owned, orphan)
+
+	mf := gatherFamilies(g, e)["kube_application_orphaned"]
+	g.Expect(findMetric(mf, map[string]string{"application": "owned"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "orphan"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestSharding(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var objs []runtime.Object
+	for i := 0; i < 20; i++ {
+		objs = append(objs, newApplication("default", fmt.Sprintf("app-%d", i), map[string]string{"app": "web"}))
+	}
+
+	seen := map[string]int{}
+	for shard := 0; shard < 2; shard++ {
+		e := newTestExporter(g, Options{ShardIndex: shard, ShardTotal: 2}, objs...)
+		mf := gatherFamilies(g, e)["kube_application_orphaned"]
+		g.Expect(mf.GetMetric()).NotTo(gomega.BeEmpty())
+		for _, m := range mf.GetMetric() {
+			for _, lp := range m.GetLabel() {
+				if lp.GetName() == "application" {
+					seen[lp.GetValue()]++
+				}
+			}
+		}
+	}
+
+	g.Expect(seen).To(gomega.HaveLen(20))
+	for name, count := range seen {
+		g.Expect(count).To(gomega.Equal(1), name)
+	}
+}
+
+func TestShardingInvalidIndex(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	_, err := NewAppExporter(Options{ShardIndex: 2, ShardTotal: 2})
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestSpecHash(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	a := newApplication("default", "a", map[string]string{"app": "web", "tier": "frontend"})
+	a.Spec.ComponentGroupKinds = []metav1.GroupKind{{Group: "apps", Kind: "Deployment"}, {Group: "", Kind: "Service"}}
+	b := newApplication("default", "b", map[string]string{"tier": "frontend", "app": "web"})
+	b.Spec.ComponentGroupKinds = []metav1.GroupKind{{Group: "", Kind: "Service"}, {Group: "apps", Kind: "Deployment"}}
+	c := a.DeepCopy()
+	c.Name = "c"
+	c.Spec.Selector.MatchLabels["app"] = "api"
+
+	g.Expect(specHash(a.Spec)).To(gomega.Equal(specHash(b.Spec)))
+	g.Expect(specHash(a.Spec)).NotTo(gomega.Equal(specHash(c.Spec)))
+
+	// Expressions on the same key and operator are ordered by their values.
+	in := func(key string, values ...string) metav1.LabelSelectorRequirement {
+		return metav1.LabelSelectorRequirement{Key: key, Operator: metav1.LabelSelectorOpIn, Values: values}
+	}
+	d := a.DeepCopy()
+	d.Spec.Selector.MatchExpressions = []metav1.LabelSelectorRequirement{in("tier", "frontend", "edge"), in("tier", "web")}
+	f := a.DeepCopy()
+	f.Spec.Selector.MatchExpressions = []metav1.LabelSelectorRequirement{in("tier", "web"), in("tier", "edge", "frontend")}
+	g.Expect(specHash(d.Spec)).To(gomega.Equal(specHash(f.Spec)))
+
+	e := newTestExporter(g, Options{}, a, b, c)
+	mf := gatherFamilies(g, e)["kube_application_spec_hash"]
+	g.Expect(findMetric(mf, map[string]string{"application": "a", "hash": specHash(a.Spec)})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"application": "b", "hash": specHash(a.Spec)})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"application": "c", "hash": specHash(c.Spec)})).NotTo(gomega.BeNil())
+}
+
+func TestExcludeSystemNamespaces(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	objs := []runtime.Object{
+		newApplication("kube-system", "dns", map[string]string{"app": "dns"}),
+		newApplication("default", "web", map[string]string{"app": "web"}),
+		newApplication("infra", "ingress", map[string]string{"app": "ingress"}),
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{}, objs...))["kube_application_orphaned"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{ExcludeSystemNamespaces: true}, objs...))["kube_application_orphaned"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "kube-system"})).To(gomega.BeNil())
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{ExcludeSystemNamespaces: true, SystemNamespaces: []string{"infra"}}, objs...))["kube_application_orphaned"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "infra"})).To(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"namespace": "kube-system"})).NotTo(gomega.BeNil())
+}
+
+func TestImagePodCount(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	pod0 := newPod("default", "web-0", lbls, "nginx", "nginx-copy")
+	pod0.Spec.Containers[1].Image = "nginx:latest"
+	pod1 := newPod("default", "web-1", lbls, "nginx")
+	pod2 := newPod("default", "web-2", lbls, "envoy")
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls), pod0, pod1, pod2)
+
+	mf := gatherFamilies(g, e)["kube_application_image_pod_count"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "image": "nginx:latest"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "image": "envoy:latest"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestHealthzLightweight(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	healthy := newTestExporter(g, Options{HealthCheckLightweight: true}, newApplication("default", "web", nil))
+	rec := httptest.NewRecorder()
+	healthy.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	g.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+	broken := newTestExporter(g, Options{
+		HealthCheckLightweight: true,
+		Client:                 listErrorClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme), err: errors.New("connection refused")},
+	})
+	rec = httptest.NewRecorder()
+	broken.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	g.Expect(rec.Code).To(gomega.Equal(http.StatusServiceUnavailable))
+	g.Expect(rec.Body.String()).To(gomega.ContainSubstring("connection refused"))
+}
+
+func TestHealthzLastScrape(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	e := newTestExporter(g, Options{
+		Client: listErrorClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme), err: errors.New("connection refused")},
+	})
+
+	rec := httptest.NewRecorder()
+	e.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	g.Expect(rec.Code).To(gomega.Equal(http.StatusOK))
+
+	gatherFamilies(g, e)
+	rec = httptest.NewRecorder()
+	e.Healthz(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	g.Expect(rec.Code).To(gomega.Equal(http.StatusServiceUnavailable))
+}
+
+func TestStatusLastUpdate(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	earlier := metav1.NewTime(time.Unix(1600000000, 0))
+	later := metav1.NewTime(time.Unix(1600000500, 0))
+	app := newApplication("default", "web", nil)
+	app.Status.Conditions = []appv1beta1.Condition{
+		{Type: appv1beta1.Ready, Status: v1.ConditionTrue, LastUpdateTime: later},
+		{Type: appv1beta1.Error, Status: v1.ConditionFalse, LastUpdateTime: earlier},
+	}
+	e := newTestExporter(g, Options{}, app, newApplication("default", "fresh", nil))
+
+	mf := gatherFamilies(g, e)["kube_application_status_last_update"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(1600000500.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "fresh"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+}
+
+func TestContainerProbes(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	pod := newPod("default", "web-0", lbls, "nginx")
+	pod.Spec.Containers[0].ReadinessProbe = &v1.Probe{Handler: v1.Handler{HTTPGet: &v1.HTTPGetAction{Path: "/ready"}}}
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls), pod)
+
+	mf := gatherFamilies(g, e)["kube_application_container_probes"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	probe := func(name string) float64 {
+		return findMetric(mf, map[string]string{"pod": "web-0", "container": "nginx", "probe": name}).GetGauge().GetValue()
+	}
+	g.Expect(probe("readiness")).To(gomega.Equal(1.0))
+	g.Expect(probe("liveness")).To(gomega.Equal(0.0))
+	g.Expect(probe("startup")).To(gomega.Equal(0.0))
+}
+
+func TestApplicationFilter(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	monitored := newApplication("default", "monitored", nil)
+	monitored.Annotations = map[string]string{"example.com/monitor": "true"}
+	ignored := newApplication("default", "ignored", nil)
+	e := newTestExporter(g, Options{
+		ApplicationFilter: func(app appv1beta1.Application) bool {
+			return app.Annotations["example.com/monitor"] == "true"
+		},
+	}, monitored, ignored)
+
+	mf := gatherFamilies(g, e)["kube_application_orphaned"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(findMetric(mf, map[string]string{"application": "monitored"})).NotTo(gomega.BeNil())
+}
+
+func TestListRestartOnResourceExpired(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var apps []appv1beta1.Application
+	for i := 0; i < 5; i++ {
+		apps = append(apps, *newApplication("default", fmt.Sprintf("app-%d", i), nil))
+	}
+	paged := &pagedClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme), apps: apps, expireAfter: 1}
+	e := newTestExporter(g, Options{Client: paged, ListPageSize: 2})
+
+	families := gatherFamilies(g, e)
+	g.Expect(families["kube_application_orphaned"].GetMetric()).To(gomega.HaveLen(5))
+	g.Expect(families["kube_application_list_restart_total"].GetMetric()[0].GetCounter().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(families["exporter_last_scrape_error"].GetMetric()[0].GetGauge().GetValue()).To(gomega.Equal(0.0))
+	// first page, expired second page, then three pages from the start
+	g.Expect(paged.calls).To(gomega.Equal(5))
+}
+
+func TestListRestartGivesUp(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var apps []appv1beta1.Application
+	for i := 0; i < 5; i++ {
+		apps = append(apps, *newApplication("default", fmt.Sprintf("app-%d", i), nil))
+	}
+	paged := &pagedClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme), apps: apps, expireAfter: 100}
+	e := newTestExporter(g, Options{Client: paged, ListPageSize: 2})
+
+	families := gatherFamilies(g, e)
+	g.Expect(families).NotTo(gomega.HaveKey("kube_application_orphaned"))
+	g.Expect(families).To(gomega.HaveKey("exporter_last_scrape_error"))
+	g.Expect(families["kube_application_list_restart_total"].GetMetric()[0].GetCounter().GetValue()).To(gomega.Equal(float64(maxListRestarts)))
+}
+
+func TestPodAnnotationFilter(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	monitored := newPod("default", "web-0", lbls, "nginx")
+	monitored.Annotations = map[string]string{"monitoring": "enabled", "other": "x"}
+	disabled := newPod("default", "web-1", lbls, "nginx")
+	disabled.Annotations = map[string]string{"monitoring": "disabled"}
+	plain := newPod("default", "web-2", lbls, "nginx")
+	e := newTestExporter(g, Options{PodAnnotationFilter: map[string]string{"monitoring": "enabled"}},
+		newApplication("default", "web", lbls), monitored, disabled, plain)
+
+	families := gatherFamilies(g, e)
+	g.Expect(families["kube_pod_owner"].GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(findMetric(families["kube_pod_owner"], map[string]string{"pod": "web-0"})).NotTo(gomega.BeNil())
+	g.Expect(families["kube_application_pod_node"].GetMetric()).To(gomega.HaveLen(3))
+}
+
+func TestPodAnnotationFilterInvalidLabelValue(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	owned := newPod("default", "web-0", lbls, "nginx")
+	owned.Annotations = map[string]string{"owner": "team a"}
+	other := newPod("default", "web-1", lbls, "nginx")
+	other.Annotations = map[string]string{"owner": "team b"}
+	e := newTestExporter(g, Options{PodAnnotationFilter: map[string]string{"owner": "team a"}},
+		newApplication("default", "web", lbls), owned, other, newPod("default", "web-2", lbls, "nginx"))
+
+	mf := gatherFamilies(g, e)["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0"})).NotTo(gomega.BeNil())
+}
+
+// countingClient counts the List calls made per list type.
+type countingClient struct {
+	client.Client
+	lists map[string]int
+	gets  map[string]int
+}
+
+func (c *countingClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if c.lists == nil {
+		c.lists = map[string]int{}
+	}
+	c.lists[fmt.Sprintf("%T", list)]++
+	return c.Client.List(ctx, list, opts...)
+}
+
+func (c *countingClient) Get(ctx context.Context, key client.ObjectKey, obj runtime.Object) error {
+	if c.gets == nil {
+		c.gets = map[string]int{}
+	}
+	c.gets[fmt.Sprintf("%T", obj)]++
+	return c.Client.Get(ctx, key, obj)
+}
+
+func newNode(name, zone string) *v1.Node {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if zone != "" {
+		node.Labels = map[string]string{v1.LabelZoneFailureDomainStable: zone}
+	}
+	return node
+}
+
+func TestZones(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	batch := map[string]string{"app": "batch"}
+	pods := []*v1.Pod{
+		newPod("default", "web-0", web, "nginx"),
+		newPod("default", "web-1", web, "nginx"),
+		newPod("default", "web-2", web, "nginx"),
+		newPod("default", "batch-0", batch, "job"),
+	}
+	pods[0].Spec.NodeName = "node-a"
+	pods[1].Spec.NodeName = "node-b"
+	pods[2].Spec.NodeName = "node-c"
+	counting := &countingClient{
+		Client: fake.NewFakeClientWithScheme(scheme.Scheme,
+			newApplication("default", "web", web), newApplication("default", "batch", batch),
+			pods[0], pods[1], pods[2], pods[3],
+			newNode("node-a", "zone-1"), newNode("node-b", "zone-2"), newNode("node-c", "zone-2"),
+		),
+		lists: map[string]int{},
+	}
+	e := newTestExporter(g, Options{Client: counting, CollectZones: true})
+
+	mf := gatherFamilies(g, e)["kube_application_zones"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "batch"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(counting.lists["*v1.NodeList"]).To(gomega.Equal(1))
+}
+
+// nodeListErrorClient fails listing Nodes.
+type nodeListErrorClient struct {
+	client.Client
+}
+
+func (c nodeListErrorClient) List(ctx context.Context, list runtime.Object, opts ...client.ListOption) error {
+	if _, ok := list.(*v1.NodeList); ok {
+		return errors.New("forbidden")
+	}
+	return c.Client.List(ctx, list, opts...)
+}
+
+func TestZonesNodeListError(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	batch := map[string]string{"app": "batch"}
+	counting := &countingClient{
+		Client: nodeListErrorClient{fake.NewFakeClientWithScheme(scheme.Scheme,
+			newApplication("default", "web", web), newApplication("default", "batch", batch),
+			newPod("default", "web-0", web, "nginx"), newPod("default", "batch-0", batch, "job"),
+		)},
+	}
+	logged := 0
+	e := newTestExporter(g, Options{Client: counting, CollectZones: true, Log: errorCountingLogger{errors: &logged}})
+
+	families := gatherFamilies(g, e)
+	g.Expect(families).NotTo(gomega.HaveKey("kube_application_zones"))
+	g.Expect(counting.lists["*v1.NodeList"]).To(gomega.Equal(1))
+	g.Expect(logged).To(gomega.Equal(1))
+}
+
+func TestMatchedPodsDelta(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	c := fake.NewFakeClientWithScheme(scheme.Scheme,
+		newApplication("default", "web", lbls),
+		newPod("default", "web-0", lbls, "nginx"),
+		newPod("default", "web-1", lbls, "nginx"),
+		newPod("default", "web-2", lbls, "nginx"),
+	)
+	e := newTestExporter(g, Options{Client: c})
+	delta := func() float64 {
+		mf := gatherFamilies(g, e)["kube_application_matched_pods_delta"]
+		return findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()
+	}
+
+	g.Expect(delta()).To(gomega.Equal(0.0))
+
+	g.Expect(c.Delete(context.TODO(), newPod("default", "web-1", nil))).To(gomega.Succeed())
+	g.Expect(c.Delete(context.TODO(), newPod("default", "web-2", nil))).To(gomega.Succeed())
+	g.Expect(delta()).To(gomega.Equal(-2.0))
+
+	g.Expect(c.Create(context.TODO(), newPod("default", "web-3", lbls, "nginx"))).To(gomega.Succeed())
+	g.Expect(delta()).To(gomega.Equal(1.0))
+}
+
+func TestScrapeErrorOnSuccess(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	app := newApplication("default", "web", nil)
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{}, app))["exporter_last_scrape_error"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(mf.GetMetric()[0].GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(findMetric(mf, map[string]string{"err": ""})).NotTo(gomega.BeNil())
+
+	disabled := false
+	families := gatherFamilies(g, newTestExporter(g, Options{EmitScrapeErrorOnSuccess: &disabled}, app))
+	g.Expect(families).NotTo(gomega.HaveKey("exporter_last_scrape_error"))
+
+	broken := newTestExporter(g, Options{
+		Client: listErrorClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme), err: errors.New("connection refused")},
+	})
+	mf = gatherFamilies(g, broken)["exporter_last_scrape_error"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(findMetric(mf, map[string]string{"err": "connection refused"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestMissingReadyCondition(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	errorOnly := newApplication("default", "error-only", nil)
+	errorOnly.Status.Conditions = []appv1beta1.Condition{{Type: appv1beta1.Error, Status: v1.ConditionTrue, Reason: "ErrorSeen"}}
+	ready := newApplication("default", "ready", nil)
+	ready.Status.Conditions = []appv1beta1.Condition{{Type: appv1beta1.Ready, Status: v1.ConditionFalse}}
+	e := newTestExporter(g, Options{}, errorOnly, ready)
+
+	mf := gatherFamilies(g, e)["kube_application_missing_ready_condition"]
+	g.Expect(findMetric(mf, map[string]string{"application": "error-only"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "ready"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+}
+
+func TestPodsByPriorityClass(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	critical0 := newPod("default", "web-0", lbls, "nginx")
+	critical0.Spec.PriorityClassName = "critical"
+	critical1 := newPod("default", "web-1", lbls, "nginx")
+	critical1.Spec.PriorityClassName = "critical"
+	batch := newPod("default", "web-2", lbls, "nginx")
+	batch.Spec.PriorityClassName = "batch"
+	unset := newPod("default", "web-3", lbls, "nginx")
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls), critical0, critical1, batch, unset)
+
+	mf := gatherFamilies(g, e)["kube_application_pods_by_priority_class"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"priority_class": "critical"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"priority_class": "batch"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"priority_class": "none"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestServiceType(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	internal := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-internal", Labels: lbls},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeClusterIP},
+	}
+	public := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-public", Labels: lbls},
+		Spec:       v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer},
+	}
+	unrelated := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db", Labels: map[string]string{"app": "db"}},
+	}
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls), internal, public, unrelated)
+
+	mf := gatherFamilies(g, e)["kube_application_service_type"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "service": "web-internal", "type": "ClusterIP"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "service": "web-public", "type": "LoadBalancer"})).NotTo(gomega.BeNil())
+}
+
+func TestCollectOne(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	db := map[string]string{"app": "db"}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", web),
+		newApplication("default", "db", db),
+		newPod("default", "web-0", web, "nginx"),
+		newPod("default", "db-0", db, "mysql"),
+	)
+
+	metrics, err := e.CollectOne(context.TODO(), "default", "web")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(metrics).NotTo(gomega.BeEmpty())
+	owners := 0
+	for _, m := range metrics {
+		pb := &dto.Metric{}
+		g.Expect(m.Write(pb)).To(gomega.Succeed())
+		for _, lp := range pb.GetLabel() {
+			if lp.GetName() == "application" || lp.GetName() == "owner_name" {
+				g.Expect(lp.GetValue()).To(gomega.Equal("web"))
+			}
+		}
+		if m.Desc() == e.KubePodOwner {
+			owners++
+		}
+	}
+	g.Expect(owners).To(gomega.Equal(1))
+}
+
+func TestCollectOneNotFound(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	e := newTestExporter(g, Options{}, newApplication("default", "web", nil))
+
+	metrics, err := e.CollectOne(context.TODO(), "default", "missing")
+	g.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue())
+	g.Expect(metrics).To(gomega.BeNil())
+}
+
+func TestPodTolerations(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	none := newPod("default", "web-0", lbls, "nginx")
+	many := newPod("default", "web-1", lbls, "nginx")
+	many.Spec.Tolerations = []v1.Toleration{
+		{Key: "node.kubernetes.io/not-ready", Operator: v1.TolerationOpExists},
+		{Key: "node.kubernetes.io/unreachable", Operator: v1.TolerationOpExists},
+		{Operator: v1.TolerationOpExists},
+	}
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls), none, many)
+
+	mf := gatherFamilies(g, e)["kube_application_pod_tolerations"]
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-1"}).GetGauge().GetValue()).To(gomega.Equal(3.0))
+}
+
+func TestMainImage(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	annotated := newPod("default", "web-0", lbls, "istio-proxy", "nginx")
+	annotated.Annotations = map[string]string{"example.com/main-container": "nginx"}
+	fallback := newPod("default", "web-1", lbls, "istio-proxy", "nginx")
+	e := newTestExporter(g, Options{MainContainerAnnotation: "example.com/main-container"},
+		newApplication("default", "web", lbls), annotated, fallback)
+
+	mf := gatherFamilies(g, e)["kube_application_main_image"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "container": "nginx", "image": "nginx:latest"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-1", "container": "istio-proxy", "image": "istio-proxy:latest"})).NotTo(gomega.BeNil())
+}
+
+func TestCountByTeam(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	team := func(app *appv1beta1.Application, name string) *appv1beta1.Application {
+		app.Annotations = map[string]string{"example.com/team": name}
+		return app
+	}
+	e := newTestExporter(g, Options{TeamAnnotation: "example.com/team"},
+		team(newApplication("default", "web", nil), "frontend"),
+		team(newApplication("default", "cdn", nil), "frontend"),
+		team(newApplication("default", "db", nil), "storage"),
+		newApplication("default", "legacy", nil),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_count_by_team"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"team": "frontend"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"team": "storage"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"team": "unknown"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestDegradedPods(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	restarts := func(pod *v1.Pod, counts ...int32) *v1.Pod {
+		for i, count := range counts {
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, v1.ContainerStatus{Name: pod.Spec.Containers[i].Name, RestartCount: count})
+		}
+		return pod
+	}
+	objs := []runtime.Object{
+		newApplication("default", "web", lbls),
+		restarts(newPod("default", "web-0", lbls, "nginx"), 2),
+		restarts(newPod("default", "web-1", lbls, "nginx", "sidecar"), 0, 6),
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{RestartThreshold: 3}, objs...))["kube_application_degraded_pods"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{RestartThreshold: 1}, objs...))["kube_application_degraded_pods"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{}, objs...))["kube_application_degraded_pods"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestExporterConfig(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{ShardIndex: 1, ShardTotal: 4}))["kube_application_exporter_config"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(findMetric(mf, map[string]string{
+		"namespace":         "all",
+		"concurrency":       "1",
+		"cache_ttl_seconds": "0",
+		"shard_index":       "1",
+		"shard_total":       "4",
+	}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{}))["kube_application_exporter_config"]
+	g.Expect(findMetric(mf, map[string]string{"shard_index": "0", "shard_total": "1"})).NotTo(gomega.BeNil())
+}
+
+// firstOwnerResolver reports a pod's first owner reference as its owner.
+type firstOwnerResolver struct{}
+
+func (firstOwnerResolver) Resolve(pod v1.Pod, app appv1beta1.Application) (string, string, bool) {
+	if len(pod.OwnerReferences) == 0 {
+		return "<none>", "<none>", false
+	}
+	ref := pod.OwnerReferences[0]
+	return ref.Kind, ref.Name, ref.Controller != nil && *ref.Controller
+}
+
+func TestOwnerResolver(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	isController := true
+	owned := newPod("default", "web-0", lbls, "nginx")
+	owned.OwnerReferences = []metav1.OwnerReference{
+		{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "web-5d4f", UID: "1", Controller: &isController},
+		{APIVersion: "v1", Kind: "ConfigMap", Name: "unrelated", UID: "2"},
+	}
+	bare := newPod("default", "web-1", lbls, "nginx")
+	objs := []runtime.Object{newApplication("default", "web", lbls), owned, bare}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{}, objs...))["kube_pod_owner"]
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "owner_kind": "Application", "owner_name": "web", "owner_is_controller": "true"})).NotTo(gomega.BeNil())
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{OwnerResolver: firstOwnerResolver{}}, objs...))["kube_pod_owner"]
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "owner_kind": "ReplicaSet", "owner_name": "web-5d4f", "owner_is_controller": "true"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-1", "owner_kind": "<none>", "owner_name": "<none>", "owner_is_controller": "false"})).NotTo(gomega.BeNil())
+
+	objs = append(objs, newApplication("default", "frontend", lbls))
+	mf = gatherFamilies(g, newTestExporter(g, Options{OwnerResolver: firstOwnerResolver{}}, objs...))["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+}
+
+// ownedPod returns a pod controlled by a ReplicaSet of the given Deployment,
+// or by a ReplicaSet of that name when hash is empty.
+func ownedPod(namespace, name string, lbls map[string]string, deployment, hash string) *v1.Pod {
+	pod := newPod(namespace, name, map[string]string{}, "nginx")
+	for k, v := range lbls {
+		pod.Labels[k] = v
+	}
+	isController := true
+	rsName := deployment
+	if hash != "" {
+		pod.Labels["pod-template-hash"] = hash
+		rsName = deployment + "-" + hash
+	}
+	pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: rsName, UID: types.UID(rsName), Controller: &isController}}
+	return pod
+}
+
+func TestDistinctWorkloads(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		ownedPod("default", "web-0", lbls, "web", "5d4f"),
+		ownedPod("default", "web-1", lbls, "web", "5d4f"),
+		ownedPod("default", "web-2", lbls, "web", "7b8c"),
+		ownedPod("default", "api-0", lbls, "api", "9e0a"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_distinct_workloads"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+}
+
+func TestPodsDefaultServiceAccount(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	custom := newPod("default", "web-1", lbls, "nginx")
+	custom.Spec.ServiceAccountName = "web"
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		newPod("default", "web-0", lbls, "nginx"),
+		custom,
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_pods_default_sa"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestExtraPodSelector(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	e := newTestExporter(g, Options{ExtraPodSelector: map[string]string{"tenant": "a"}},
+		newApplication("default", "web", lbls),
+		newPod("default", "web-0", map[string]string{"app": "web", "tenant": "a"}, "nginx"),
+		newPod("default", "web-1", map[string]string{"app": "web", "tenant": "b"}, "nginx"),
+		newPod("default", "web-2", lbls, "nginx"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0"})).NotTo(gomega.BeNil())
+}
+
+func TestExtraPodSelectorInvalid(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	_, err := NewAppExporter(Options{ExtraPodSelector: map[string]string{"tenant/a/b": "a"}})
+	g.Expect(err).To(gomega.HaveOccurred())
+	_, err = NewAppExporter(Options{ExtraPodSelector: map[string]string{"tenant": "team a"}})
+	g.Expect(err).To(gomega.HaveOccurred())
+}
+
+func TestAddOwnerRef(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{appsv1.SchemeGroupVersion})
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+
+	owning := newApplication("default", "web", lbls)
+	owning.Spec.AddOwnerRef = true
+	owning.Spec.ComponentGroupKinds = []metav1.GroupKind{{Group: "apps", Kind: "Deployment"}}
+	plain := newApplication("other", "web", lbls)
+	owned := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Labels: lbls, OwnerReferences: []metav1.OwnerReference{{
+			APIVersion: appv1beta1.GroupVersion.String(),
+			Kind:       appv1beta1.ResourceKindApplication,
+			Name:       "web",
+		}}},
+	}
+	unowned := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "api", Labels: lbls},
+	}
+	e := newTestExporter(g, Options{Mapper: mapper}, owning, plain, owned, unowned)
+
+	families := gatherFamilies(g, e)
+	mf := families["kube_application_add_owner_ref"]
+	g.Expect(findMetric(mf, map[string]string{"namespace": "default", "application": "web"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "other", "application": "web"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+
+	mf = families["kube_application_components_missing_owner_ref"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(1))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "default", "application": "web"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestContainerEnvSources(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	pod := newPod("default", "web-0", lbls, "nginx")
+	pod.Spec.Containers[0].EnvFrom = []v1.EnvFromSource{{
+		ConfigMapRef: &v1.ConfigMapEnvSource{LocalObjectReference: v1.LocalObjectReference{Name: "web-config"}},
+	}}
+	pod.Spec.Containers[0].Env = []v1.EnvVar{
+		{Name: "MODE", Value: "production"},
+		{Name: "PASSWORD", ValueFrom: &v1.EnvVarSource{
+			SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: "web-secret"}, Key: "password"},
+		}},
+	}
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls), pod)
+
+	mf := gatherFamilies(g, e)["kube_application_container_env_sources"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "container": "nginx", "source": "configmap"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "container": "nginx", "source": "secret"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestComponentKindMismatch(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{appsv1.SchemeGroupVersion})
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+
+	declared := func(namespace string) *appv1beta1.Application {
+		app := newApplication(namespace, "web", lbls)
+		app.Spec.ComponentGroupKinds = []metav1.GroupKind{{Group: "apps", Kind: "Deployment"}}
+		return app
+	}
+	e := newTestExporter(g, Options{Mapper: mapper, CheckComponentKindMismatch: true},
+		// Only bare pods match the declared Deployment kind.
+		declared("stale"),
+		newPod("stale", "web-0", lbls, "nginx"),
+		declared("default"),
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web", Labels: lbls}},
+		ownedPod("default", "web-0", lbls, "web", "5d4f"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_component_kind_mismatch"]
+	g.Expect(findMetric(mf, map[string]string{"namespace": "stale"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "default"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+
+	e = newTestExporter(g, Options{Mapper: mapper}, declared("stale"), newPod("stale", "web-0", lbls, "nginx"))
+	g.Expect(gatherFamilies(g, e)).NotTo(gomega.HaveKey("kube_application_component_kind_mismatch"))
+}
+
+func TestErrorLogInterval(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	failing := listErrorClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme), err: errors.New("connection refused")}
+	scrape := func(e *Exporter, times int) {
+		for i := 0; i < times; i++ {
+			mf := gatherFamilies(g, e)["exporter_last_scrape_error"]
+			g.Expect(findMetric(mf, map[string]string{"err": "connection refused"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+		}
+	}
+
+	var logged int
+	fakeClock := clock.NewFakeClock(time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC))
+	e := newTestExporter(g, Options{Client: failing, Log: errorCountingLogger{errors: &logged}, ErrorLogInterval: time.Minute, Clock: fakeClock})
+	scrape(e, 5)
+	g.Expect(logged).To(gomega.Equal(1))
+
+	// Logging resumes once per interval while the outage lasts.
+	fakeClock.Step(30 * time.Second)
+	scrape(e, 1)
+	g.Expect(logged).To(gomega.Equal(1))
+	fakeClock.Step(31 * time.Second)
+	scrape(e, 3)
+	g.Expect(logged).To(gomega.Equal(2))
+
+	// A successful scrape ends the outage, so the next failure is logged again.
+	e.options.Client = failing.Client
+	gatherFamilies(g, e)
+	e.options.Client = failing
+	scrape(e, 3)
+	g.Expect(logged).To(gomega.Equal(3))
+
+	logged = 0
+	e = newTestExporter(g, Options{Client: failing, Log: errorCountingLogger{errors: &logged}})
+	scrape(e, 3)
+	g.Expect(logged).To(gomega.Equal(3))
+}
+
+func TestPodsWithoutLimits(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	limited := newPod("default", "web-0", lbls, "nginx")
+	limited.Spec.Containers[0].Resources.Limits = v1.ResourceList{
+		v1.ResourceCPU:    resource.MustParse("500m"),
+		v1.ResourceMemory: resource.MustParse("128Mi"),
+	}
+	cpuOnly := newPod("default", "web-1", lbls, "nginx")
+	cpuOnly.Spec.Containers[0].Resources.Limits = v1.ResourceList{v1.ResourceCPU: resource.MustParse("500m")}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		limited,
+		cpuOnly,
+		newPod("default", "web-2", lbls, "nginx"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_pods_without_limits"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+}
+
+func TestAggregateByWorkload(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	objs := []runtime.Object{
+		newApplication("default", "web", lbls),
+		ownedPod("default", "web-0", lbls, "web", "5d4f"),
+		ownedPod("default", "web-1", lbls, "web", "5d4f"),
+		ownedPod("default", "web-2", lbls, "web", "7b8c"),
+		newPod("default", "debug", lbls, "busybox"),
+	}
+
+	perPod := gatherFamilies(g, newTestExporter(g, Options{}, objs...))
+	g.Expect(perPod["kube_pod_owner"].GetMetric()).To(gomega.HaveLen(4))
+	g.Expect(perPod).NotTo(gomega.HaveKey("kube_application_workload"))
+
+	aggregated := gatherFamilies(g, newTestExporter(g, Options{AggregateByWorkload: true}, objs...))
+	g.Expect(aggregated).NotTo(gomega.HaveKey("kube_pod_owner"))
+	mf := aggregated["kube_application_workload"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"workload_kind": "Deployment", "workload_name": "web"}).GetGauge().GetValue()).To(gomega.Equal(3.0))
+	g.Expect(findMetric(mf, map[string]string{"workload_kind": "Pod", "workload_name": "debug"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestReconcileError(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	withError := func(name, reason string, status v1.ConditionStatus) *appv1beta1.Application {
+		app := newApplication("default", name, map[string]string{"app": name})
+		app.Status.Conditions = []appv1beta1.Condition{{Type: appv1beta1.Error, Status: status, Reason: reason}}
+		return app
+	}
+	e := newTestExporter(g, Options{ReconcileErrorReasons: []string{"QuotaExceeded"}},
+		withError("web", "ComponentNotFound", v1.ConditionTrue),
+		withError("api", "SomethingNew", v1.ConditionTrue),
+		withError("db", "QuotaExceeded", v1.ConditionTrue),
+		withError("cache", "NoError", v1.ConditionFalse),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_reconcile_error"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"application": "web", "reason": "ComponentNotFound"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "api", "reason": "other"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"application": "db", "reason": "QuotaExceeded"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"application": "cache"})).To(gomega.BeNil())
+}
+
+func TestMinPods(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	db := map[string]string{"app": "db"}
+	e := newTestExporter(g, Options{MinPods: 2, TeamAnnotation: "team"},
+		newApplication("default", "web", web),
+		newPod("default", "web-0", web, "nginx"),
+		newPod("default", "web-1", web, "nginx"),
+		newApplication("default", "db", db),
+		newPod("default", "db-0", db, "mysql"),
+	)
+
+	families := gatherFamilies(g, e)
+	mf := families["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"pod": "db-0"})).To(gomega.BeNil())
+	g.Expect(findMetric(families["kube_application_count_by_team"], map[string]string{"team": "unknown"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(families["kube_application_pod_node"], map[string]string{"pod": "db-0"})).NotTo(gomega.BeNil())
+}
+
+func TestSelectorOverlap(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	objs := []runtime.Object{
+		newApplication("default", "web", map[string]string{"app": "web"}),
+		newApplication("default", "frontend", map[string]string{"tier": "frontend"}),
+		newApplication("default", "db", map[string]string{"app": "db"}),
+		newApplication("other", "web", map[string]string{"app": "web"}),
+		newPod("default", "web-0", map[string]string{"app": "web", "tier": "frontend"}, "nginx"),
+		newPod("default", "db-0", map[string]string{"app": "db"}, "mysql"),
+		newPod("other", "web-0", map[string]string{"app": "web"}, "nginx"),
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{DetectSelectorOverlap: true}, objs...))["kube_application_selector_overlap"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "default", "application": "web", "overlaps_with": "frontend"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "default", "application": "frontend", "overlaps_with": "web"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+
+	g.Expect(gatherFamilies(g, newTestExporter(g, Options{}, objs...))).NotTo(gomega.HaveKey("kube_application_selector_overlap"))
+}
+
+func TestUntrustedImages(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	image := func(pod *v1.Pod, images ...string) *v1.Pod {
+		for i, image := range images {
+			pod.Spec.Containers[i].Image = image
+		}
+		return pod
+	}
+	objs := []runtime.Object{
+		newApplication("default", "web", lbls),
+		image(newPod("default", "web-0", lbls, "nginx", "sidecar"), "nginx:1.19", "gcr.io/project/sidecar:v1"),
+		image(newPod("default", "web-1", lbls, "nginx"), "quay.io/team/nginx:1.19"),
+		image(newPod("default", "web-2", lbls, "nginx"), "localhost:5000/nginx"),
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{TrustedRegistries: []string{"docker.io", "gcr.io"}}, objs...))["kube_application_untrusted_images"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+
+	g.Expect(gatherFamilies(g, newTestExporter(g, Options{}, objs...))).NotTo(gomega.HaveKey("kube_application_untrusted_images"))
+
+	g.Expect(imageRegistry("library/nginx")).To(gomega.Equal("docker.io"))
+	g.Expect(imageRegistry("index.docker.io/library/nginx")).To(gomega.Equal("docker.io"))
+	g.Expect(imageRegistry("registry.example.com:5000/nginx")).To(gomega.Equal("registry.example.com:5000"))
+}
+
+func TestNamespaceLabels(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	c := &countingClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme,
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"env": "prod", "app.kubernetes.io/team": "payments"}}},
+		newApplication("default", "web", lbls),
+		newApplication("default", "api", lbls),
+		newPod("default", "web-0", lbls, "nginx"),
+	)}
+	e := newTestExporter(g, Options{Client: c, NamespaceLabels: []string{"env", "app.kubernetes.io/team", "missing"}})
+
+	mf := gatherFamilies(g, e)["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"owner_name": "web", "ns_label_env": "prod", "ns_label_app_kubernetes_io_team": "payments", "ns_label_missing": ""})).NotTo(gomega.BeNil())
+	g.Expect(c.gets["*v1.Namespace"]).To(gomega.Equal(1))
+}
+
+func TestNamespaceLabelsConflict(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	_, err := NewAppExporter(Options{NamespaceLabels: []string{"team.name", "team-name"}})
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("ns_label_team_name")))
+}
+
+func TestPodPVCs(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "db"}
+	pvc := func(name string) v1.Volume {
+		return v1.Volume{Name: name, VolumeSource: v1.VolumeSource{
+			PersistentVolumeClaim: &v1.PersistentVolumeClaimVolumeSource{ClaimName: name},
+		}}
+	}
+	pod := newPod("default", "db-0", lbls, "mysql")
+	pod.Spec.Volumes = []v1.Volume{
+		pvc("data"),
+		pvc("logs"),
+		{Name: "config", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+	}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "db", lbls),
+		pod,
+		newPod("default", "db-1", lbls, "mysql"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_pod_pvcs"]
+	g.Expect(findMetric(mf, map[string]string{"pod": "db-0"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"pod": "db-1"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+}
+
+func TestUseWorkloadOwnerForKubePodOwner(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	objs := []runtime.Object{
+		newApplication("default", "web", lbls),
+		ownedPod("default", "web-0", lbls, "web", "5d4f"),
+		newPod("default", "debug", lbls, "busybox"),
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{}, objs...))["kube_pod_owner"]
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "owner_kind": "Application", "owner_name": "web", "owner_is_controller": "true"})).NotTo(gomega.BeNil())
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{UseWorkloadOwnerForKubePodOwner: true}, objs...))["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "owner_kind": "ReplicaSet", "owner_name": "web-5d4f", "owner_is_controller": "true"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "debug", "owner_kind": "<none>", "owner_name": "<none>", "owner_is_controller": "false"})).NotTo(gomega.BeNil())
+
+	_, err := NewAppExporter(Options{UseWorkloadOwnerForKubePodOwner: true, OwnerResolver: ApplicationOwnerResolver{}})
+	g.Expect(err).To(gomega.HaveOccurred())
+
+	// Overlapping Applications resolve the shared pod to the same owner.
+	objs = append(objs, newApplication("default", "frontend", lbls))
+	mf = gatherFamilies(g, newTestExporter(g, Options{UseWorkloadOwnerForKubePodOwner: true}, objs...))["kube_pod_owner"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+}
+
+func TestConditionsByStatus(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	app := newApplication("default", "web", map[string]string{"app": "web"})
+	app.Status.Conditions = []appv1beta1.Condition{
+		{Type: appv1beta1.Ready, Status: v1.ConditionFalse},
+		{Type: appv1beta1.Error, Status: v1.ConditionTrue},
+		{Type: appv1beta1.Qualified, Status: v1.ConditionFalse},
+	}
+	e := newTestExporter(g, Options{}, app)
+
+	mf := gatherFamilies(g, e)["kube_application_conditions"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"status": "True"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(findMetric(mf, map[string]string{"status": "False"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"status": "Unknown"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+}
+
+func TestScrapeLatencyBuckets(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	upperBounds := func(e *Exporter) []float64 {
+		mf := gatherFamilies(g, e)["kube_application_scrape_duration_seconds"]
+		g.Expect(mf.GetType()).To(gomega.Equal(dto.MetricType_HISTOGRAM))
+		histogram := findMetric(mf, map[string]string{"namespace": "default", "application": "web"}).GetHistogram()
+		g.Expect(histogram.GetSampleCount()).To(gomega.Equal(uint64(1)))
+		var bounds []float64
+		for _, b := range histogram.GetBucket() {
+			bounds = append(bounds, b.GetUpperBound())
+		}
+		return bounds
+	}
+
+	e := newTestExporter(g, Options{}, newApplication("default", "web", lbls))
+	g.Expect(upperBounds(e)).To(gomega.Equal(DefaultScrapeLatencyBuckets))
+
+	e = newTestExporter(g, Options{ScrapeLatencyBuckets: []float64{0.1, 1, 10}}, newApplication("default", "web", lbls))
+	g.Expect(upperBounds(e)).To(gomega.Equal([]float64{0.1, 1, 10}))
+
+	_, err := NewAppExporter(Options{ScrapeLatencyBuckets: []float64{1, 0.1, 10}})
+	g.Expect(err).To(gomega.MatchError(gomega.ContainSubstring("increasing order")))
+}
+
+func TestBrokenLinks(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.Expect(r.Method).To(gomega.Equal(http.MethodHead))
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path != "/docs" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	app := newApplication("default", "web", map[string]string{"app": "web"})
+	app.Spec.Descriptor.Links = []appv1beta1.Link{
+		{Description: "Docs", URL: server.URL + "/docs"},
+		{Description: "Runbook", URL: server.URL + "/runbook"},
+		{Description: "User guide", URL: server.URL + "/docs"},
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{CheckDescriptorLinks: true, DescriptorLinkTimeout: time.Second}, app))["kube_application_broken_links"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"url": server.URL + "/docs"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(findMetric(mf, map[string]string{"url": server.URL + "/runbook"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+	g.Expect(atomic.LoadInt32(&requests)).To(gomega.Equal(int32(2)))
+
+	g.Expect(gatherFamilies(g, newTestExporter(g, Options{}, app))).NotTo(gomega.HaveKey("kube_application_broken_links"))
+}
+
+func TestForeignOwnedPods(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"tier": "frontend"}
+	ownedBy := func(pod *v1.Pod, application string) *v1.Pod {
+		pod.OwnerReferences = append(pod.OwnerReferences, metav1.OwnerReference{
+			APIVersion: appv1beta1.GroupVersion.String(),
+			Kind:       appv1beta1.ResourceKindApplication,
+			Name:       application,
+		})
+		return pod
+	}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "a", lbls),
+		newApplication("default", "b", lbls),
+		ownedBy(newPod("default", "a-0", lbls, "nginx"), "a"),
+		newPod("default", "unowned", lbls, "nginx"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_foreign_owned_pods"]
+	g.Expect(findMetric(mf, map[string]string{"application": "a"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "b"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestCacheAge(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	fakeClock := clock.NewFakeClock(time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC))
+	c := &countingClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, newApplication("default", "web", map[string]string{"app": "web"}))}
+	e := newTestExporter(g, Options{Client: c, CacheTTL: time.Minute, Clock: fakeClock})
+	age := func() float64 {
+		families := gatherFamilies(g, e)
+		g.Expect(families["kube_application_spec_hash"].GetMetric()).To(gomega.HaveLen(1))
+		return families["kube_application_cache_age_seconds"].GetMetric()[0].GetGauge().GetValue()
+	}
+
+	g.Expect(age()).To(gomega.Equal(0.0))
+	fakeClock.Step(30 * time.Second)
+	g.Expect(age()).To(gomega.Equal(30.0))
+	g.Expect(c.lists["*v1beta1.ApplicationList"]).To(gomega.Equal(1))
+
+	fakeClock.Step(45 * time.Second)
+	g.Expect(age()).To(gomega.Equal(0.0))
+	g.Expect(c.lists["*v1beta1.ApplicationList"]).To(gomega.Equal(2))
+
+	mf := gatherFamilies(g, e)["kube_application_exporter_config"]
+	g.Expect(findMetric(mf, map[string]string{"cache_ttl_seconds": "60"})).NotTo(gomega.BeNil())
+	g.Expect(gatherFamilies(g, newTestExporter(g, Options{}))).NotTo(gomega.HaveKey("kube_application_cache_age_seconds"))
+}
+
+func TestActivePods(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	objs := []runtime.Object{
+		newApplication("default", "db", map[string]string{"app": "db"}),
+		newPod("default", "db-0", map[string]string{"app": "db", "active": "true"}, "postgres"),
+		newPod("default", "db-1", map[string]string{"app": "db", "active": "false"}, "postgres"),
+		newPod("default", "db-2", map[string]string{"app": "db"}, "postgres"),
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{ActiveLabel: "active"}, objs...))["kube_application_active_pods"]
+	g.Expect(findMetric(mf, map[string]string{"application": "db"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+
+	g.Expect(gatherFamilies(g, newTestExporter(g, Options{}, objs...))).NotTo(gomega.HaveKey("kube_application_active_pods"))
+}
+
+func TestPrivilegedContainers(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	privileged, root, nonRoot := true, int64(0), int64(1000)
+
+	privilegedPod := newPod("default", "web-0", lbls, "nginx", "sidecar")
+	privilegedPod.Spec.Containers[1].SecurityContext = &v1.SecurityContext{Privileged: &privileged}
+	rootPod := newPod("default", "web-1", lbls, "nginx")
+	rootPod.Spec.SecurityContext = &v1.PodSecurityContext{RunAsUser: &root}
+	overriddenPod := newPod("default", "web-2", lbls, "nginx")
+	overriddenPod.Spec.SecurityContext = &v1.PodSecurityContext{RunAsUser: &root}
+	overriddenPod.Spec.Containers[0].SecurityContext = &v1.SecurityContext{RunAsUser: &nonRoot}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		privilegedPod,
+		rootPod,
+		overriddenPod,
+		newPod("default", "web-3", lbls, "nginx"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_privileged_containers"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+}
+
+func TestMetricHook(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	dropPodOwner := func(m prometheus.Metric) prometheus.Metric {
+		if strings.Contains(m.Desc().String(), `"kube_pod_owner"`) {
+			return nil
+		}
+		return m
+	}
+	e := newTestExporter(g, Options{MetricHook: dropPodOwner},
+		newApplication("default", "web", lbls),
+		newPod("default", "web-0", lbls, "nginx"),
+	)
+
+	families := gatherFamilies(g, e)
+	g.Expect(families).NotTo(gomega.HaveKey("kube_pod_owner"))
+	g.Expect(families).To(gomega.HaveKey("kube_application_pod_node"))
+}
+
+func TestPhaseCount(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	withPhase := func(name string, phase appv1beta1.ApplicationAssemblyPhase) *appv1beta1.Application {
+		app := newApplication("default", name, map[string]string{"app": name})
+		app.Spec.AssemblyPhase = phase
+		return app
+	}
+	e := newTestExporter(g, Options{},
+		withPhase("web", appv1beta1.Pending),
+		withPhase("api", appv1beta1.Pending),
+		withPhase("db", appv1beta1.Succeeded),
+		withPhase("cache", ""),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_phase_count"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"phase": "Pending"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"phase": "Succeeded"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"phase": "Failed"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+
+	order := collectInOrder(g, e, "kube_application_phase_count")
+	g.Expect(order).To(gomega.HaveLen(3))
+	for i, phase := range []string{"Pending", "Succeeded", "Failed"} {
+		g.Expect(order[i]).To(gomega.ContainSubstring(fmt.Sprintf("value:%q", phase)))
+	}
+}
+
+// patchClient records the options of the Patch calls it's handed and fails
+// them with err.
+type patchClient struct {
+	client.Client
+	err     error
+	patches []*client.PatchOptions
+}
+
+func (c *patchClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	c.patches = append(c.patches, patchOpts)
+	if patch.Type() != types.ApplyPatchType {
+		return fmt.Errorf("unexpected patch type %s", patch.Type())
+	}
+	return c.err
+}
+
+func TestCheckManageable(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	app := newApplication("default", "web", map[string]string{"app": "web"})
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Group: "app.k8s.io", Resource: "applications"}, "web", errors.New("RBAC: access denied"))
+
+	c := &patchClient{Client: fake.NewFakeClientWithScheme(scheme.Scheme, app), err: forbidden}
+	e := newTestExporter(g, Options{Client: c, CheckManageable: true})
+	g.Expect(apierrors.IsForbidden(e.CheckManageable(context.Background(), *app))).To(gomega.BeTrue())
+	g.Expect(c.patches[0].DryRun).To(gomega.Equal([]string{metav1.DryRunAll}))
+	g.Expect(c.patches[0].FieldManager).To(gomega.Equal("application-exporter"))
+
+	mf := gatherFamilies(g, e)["kube_application_not_manageable"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+
+	c.err = nil
+	mf = gatherFamilies(g, e)["kube_application_not_manageable"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+
+	g.Expect(gatherFamilies(g, newTestExporter(g, Options{}, app))).NotTo(gomega.HaveKey("kube_application_not_manageable"))
+}
+
+func TestPodsReadinessGates(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	const gate = v1.PodConditionType("target-health.elbv2.k8s.aws/web")
+	gated := func(name string, conditions ...v1.PodCondition) *v1.Pod {
+		pod := newPod("default", name, lbls, "nginx")
+		pod.Spec.ReadinessGates = []v1.PodReadinessGate{{ConditionType: gate}}
+		pod.Status.Conditions = conditions
+		return pod
+	}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		gated("web-0", v1.PodCondition{Type: gate, Status: v1.ConditionFalse}),
+		gated("web-1", v1.PodCondition{Type: gate, Status: v1.ConditionTrue}),
+		gated("web-2"),
+		newPod("default", "web-3", lbls, "nginx"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_pods_readiness_gates"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"gate": string(gate), "status": "False"}).GetGauge().GetValue()).To(gomega.Equal(2.0))
+	g.Expect(findMetric(mf, map[string]string{"gate": string(gate), "status": "True"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestUseDisplayName(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	db := map[string]string{"app": "db"}
+	named := newApplication("default", "web", web)
+	named.Spec.Descriptor.DisplayName = "Web Storefront"
+	objs := []runtime.Object{
+		named,
+		newPod("default", "web-0", web, "nginx"),
+		newApplication("default", "db", db),
+		newPod("default", "db-0", db, "mysql"),
+	}
+
+	families := gatherFamilies(g, newTestExporter(g, Options{UseDisplayName: true}, objs...))
+	mf := families["kube_pod_owner"]
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "owner_name": "Web Storefront"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "db-0", "owner_name": "db"})).NotTo(gomega.BeNil())
+	mf = families["kube_application_pod_node"]
+	g.Expect(findMetric(mf, map[string]string{"pod": "web-0", "application": "Web Storefront"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "db-0", "application": "db"})).NotTo(gomega.BeNil())
+
+	families = gatherFamilies(g, newTestExporter(g, Options{}, objs...))
+	g.Expect(findMetric(families["kube_pod_owner"], map[string]string{"pod": "web-0", "owner_name": "web"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(families["kube_application_pod_node"], map[string]string{"pod": "web-0", "application": "web"})).NotTo(gomega.BeNil())
+}
+
+func TestUseDisplayNameClash(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	web := newApplication("default", "web", lbls)
+	web.Spec.Descriptor.DisplayName = "Frontend"
+	shop := newApplication("default", "shop", lbls)
+	shop.Spec.Descriptor.DisplayName = "Frontend"
+	api := newApplication("default", "api", map[string]string{"app": "api"})
+	api.Spec.Descriptor.DisplayName = "db"
+	db := newApplication("default", "db", map[string]string{"app": "db"})
+	other := newApplication("other", "web", lbls)
+	other.Spec.Descriptor.DisplayName = "Frontend"
+	objs := []runtime.Object{
+		web, shop, api, db, other,
+		newPod("default", "web-0", lbls, "nginx"),
+		newPod("other", "web-0", lbls, "nginx"),
+	}
+
+	families := gatherFamilies(g, newTestExporter(g, Options{UseDisplayName: true, DetectSelectorOverlap: true}, objs...))
+	mf := families["kube_application_spec_hash"]
+	for _, name := range []string{"web", "shop", "api", "db"} {
+		g.Expect(findMetric(mf, map[string]string{"namespace": "default", "application": name})).NotTo(gomega.BeNil())
+	}
+	g.Expect(findMetric(mf, map[string]string{"namespace": "other", "application": "Frontend"})).NotTo(gomega.BeNil())
+	g.Expect(families["kube_application_selector_overlap"].GetMetric()).To(gomega.HaveLen(2))
+}
+
+func TestPhaseDuration(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	pending := newApplication("default", "web", map[string]string{"app": "web"})
+	pending.Spec.AssemblyPhase = appv1beta1.Pending
+	pending.Status.Conditions = []appv1beta1.Condition{
+		{Type: appv1beta1.Ready, Status: v1.ConditionFalse, LastTransitionTime: metav1.NewTime(now.Add(-90 * time.Minute))},
+		{Type: appv1beta1.Error, Status: v1.ConditionFalse, LastTransitionTime: metav1.NewTime(now.Add(-time.Minute))},
+	}
+	failed := newApplication("default", "api", map[string]string{"app": "api"})
+	failed.Spec.AssemblyPhase = appv1beta1.Failed
+	failed.Status.Conditions = []appv1beta1.Condition{
+		{Type: appv1beta1.Error, Status: v1.ConditionTrue, LastTransitionTime: metav1.NewTime(now.Add(-10 * time.Second))},
+	}
+	e := newTestExporter(g, Options{Clock: clock.NewFakeClock(now)},
+		pending,
+		failed,
+		newApplication("default", "db", map[string]string{"app": "db"}),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_phase_duration_seconds"]
+	g.Expect(findMetric(mf, map[string]string{"application": "web"}).GetGauge().GetValue()).To(gomega.Equal(5400.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "api"}).GetGauge().GetValue()).To(gomega.Equal(10.0))
+	g.Expect(findMetric(mf, map[string]string{"application": "db"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+}
+
+func TestJobCompletion(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "batch"}
+	job := func(name string, conditions ...batchv1.JobConditionType) *batchv1.Job {
+		j := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: lbls}}
+		for _, c := range conditions {
+			j.Status.Conditions = append(j.Status.Conditions, batchv1.JobCondition{Type: c, Status: v1.ConditionTrue})
+		}
+		return j
+	}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "batch", lbls),
+		job("import-1", batchv1.JobComplete),
+		job("import-2", batchv1.JobFailed),
+		job("import-3"),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_job_completion"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"job": "import-1", "status": "complete"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"job": "import-2", "status": "failed"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"job": "import-3", "status": "active"})).NotTo(gomega.BeNil())
+}
+
+func TestPodFailureReason(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	withStatus := func(name string, status v1.PodStatus) *v1.Pod {
+		pod := newPod("default", name, lbls, "nginx")
+		pod.Status = status
+		return pod
+	}
+	terminated := func(reason string) []v1.ContainerStatus {
+		return []v1.ContainerStatus{{Name: "nginx", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Reason: reason}}}}
+	}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		withStatus("evicted", v1.PodStatus{Phase: v1.PodFailed, Reason: "Evicted"}),
+		withStatus("oom", v1.PodStatus{Phase: v1.PodFailed, ContainerStatuses: terminated("OOMKilled")}),
+		withStatus("odd", v1.PodStatus{Phase: v1.PodFailed, Reason: "NodeShutdown"}),
+		withStatus("starting", v1.PodStatus{Phase: v1.PodPending, ContainerStatuses: []v1.ContainerStatus{
+			{Name: "nginx", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+		}}),
+		withStatus("running", v1.PodStatus{Phase: v1.PodRunning, ContainerStatuses: terminated("OOMKilled")}),
+	)
+
+	mf := gatherFamilies(g, e)["kube_application_pod_failure_reason"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(3))
+	g.Expect(findMetric(mf, map[string]string{"pod": "evicted", "reason": "Evicted"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "oom", "reason": "OOMKilled"})).NotTo(gomega.BeNil())
+	g.Expect(findMetric(mf, map[string]string{"pod": "odd", "reason": "other"})).NotTo(gomega.BeNil())
+}
+
+func TestExpectedMissing(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	e := newTestExporter(g, Options{ExcludeSystemNamespaces: true},
+		newApplication("default", "web", map[string]string{"app": "web"}),
+	)
+	g.Expect(gatherFamilies(g, e)).NotTo(gomega.HaveKey("kube_application_expected_missing"))
+
+	e.SetExpectedApplications([]types.NamespacedName{
+		{Namespace: "default", Name: "web"},
+		{Namespace: "default", Name: "api"},
+		{Namespace: "kube-system", Name: "dns"},
+		{Namespace: "default", Name: "api"},
+	})
+	mf := gatherFamilies(g, e)["kube_application_expected_missing"]
+	g.Expect(mf.GetMetric()).To(gomega.HaveLen(2))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "default", "application": "web"}).GetGauge().GetValue()).To(gomega.Equal(0.0))
+	g.Expect(findMetric(mf, map[string]string{"namespace": "default", "application": "api"}).GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
+
+func TestKubePodOwnerAsGauge(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	lbls := map[string]string{"app": "web"}
+	objs := []runtime.Object{
+		newApplication("default", "web", lbls),
+		newPod("default", "web-0", lbls, "nginx"),
+	}
+
+	mf := gatherFamilies(g, newTestExporter(g, Options{}, objs...))["kube_pod_owner"]
+	g.Expect(mf.GetType()).To(gomega.Equal(dto.MetricType_COUNTER))
+	g.Expect(mf.GetMetric()[0].GetCounter().GetValue()).To(gomega.Equal(1.0))
+
+	mf = gatherFamilies(g, newTestExporter(g, Options{KubePodOwnerAsGauge: true}, objs...))["kube_pod_owner"]
+	g.Expect(mf.GetType()).To(gomega.Equal(dto.MetricType_GAUGE))
+	g.Expect(mf.GetMetric()[0].GetGauge().GetValue()).To(gomega.Equal(1.0))
+}
@@ -0,0 +1,140 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	v1 "k8s.io/api/core/v1"
+	appv1beta1 "sigs.k8s.io/application/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ApplicationTopology describes an Application and the pods it selects.
+type ApplicationTopology struct {
+	Namespace string   `json:"namespace"`
+	Name      string   `json:"name"`
+	Version   string   `json:"version,omitempty"`
+	Pods      []string `json:"pods"`
+}
+
+// applicationPods is an Application with its selected pods.
+type applicationPods struct {
+	application appv1beta1.Application
+	pods        []v1.Pod
+}
+
+// topology returns the Applications in namespace, or in all namespaces when
+// empty, with their selected pods, sorted by namespace, name and pod name.
+func (e *Exporter) topology(ctx context.Context, namespace string) ([]ApplicationTopology, error) {
+	entries, err := e.applicationPods(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	topology := make([]ApplicationTopology, 0, len(entries))
+	for _, entry := range entries {
+		names := make([]string, 0, len(entry.pods))
+		for _, pod := range entry.pods {
+			names = append(names, pod.Name)
+		}
+
+		topology = append(topology, ApplicationTopology{
+			Namespace: entry.application.Namespace,
+			Name:      entry.application.Name,
+			Version:   entry.application.Spec.Descriptor.Version,
+			Pods:      names,
+		})
+	}
+	return topology, nil
+}
+
+// applicationPods lists the Applications in namespace, or in all namespaces
+// when empty, with their selected pods, sorted by namespace, name and pod name.
+func (e *Exporter) applicationPods(ctx context.Context, namespace string) ([]applicationPods, error) {
+	appList, err := e.gather(ctx, &client.ListOptions{Namespace: namespace})
+	if err != nil {
+		return nil, err
+	}
+	sortApplications(appList.Items)
+
+	entries := make([]applicationPods, 0, len(appList.Items))
+	for _, application := range appList.Items {
+		pods, err := e.PodsForApplication(ctx, application)
+		if err != nil {
+			return nil, err
+		}
+		sortPods(pods)
+		entries = append(entries, applicationPods{application: application, pods: pods})
+	}
+	return entries, nil
+}
+
+// TopologyDOT renders the Application topology in namespace, or in all
+// namespaces when empty, as a Graphviz DOT graph. Each Application links to
+// the top-level workloads owning its pods, which link to the pods; pods
+// without an owner are linked to the Application directly.
+func (e *Exporter) TopologyDOT(ctx context.Context, namespace string) (string, error) {
+	if _, ok := ctx.Value(loggerCtxKey).(logr.Logger); !ok {
+		ctx = context.WithValue(ctx, loggerCtxKey, e.options.Log.WithValues("render", "topology"))
+	}
+	entries, err := e.applicationPods(ctx, namespace)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph topology {\n")
+	for _, entry := range entries {
+		app := dotID(appv1beta1.ResourceKindApplication, entry.application.Namespace, entry.application.Name)
+		fmt.Fprintf(&b, "\t%s [shape=box];\n", app)
+
+		linked := map[workload]bool{}
+		for _, pod := range entry.pods {
+			podID := dotID("Pod", pod.Namespace, pod.Name)
+			owner := topLevelWorkload(pod)
+			if owner.kind == "Pod" && owner.name == pod.Name {
+				fmt.Fprintf(&b, "\t%s -> %s;\n", app, podID)
+				continue
+			}
+			ownerID := dotID(owner.kind, pod.Namespace, owner.name)
+			if !linked[owner] {
+				linked[owner] = true
+				fmt.Fprintf(&b, "\t%s -> %s;\n", app, ownerID)
+			}
+			fmt.Fprintf(&b, "\t%s -> %s;\n", ownerID, podID)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+// dotID returns the quoted DOT node ID of the object.
+func dotID(kind, namespace, name string) string {
+	return strconv.Quote(kind + "/" + namespace + "/" + name)
+}
+
+// TopologyHandler serves the Application to pod topology as JSON. The optional
+// namespace query parameter restricts it to a single namespace.
+func (e *Exporter) TopologyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := e.options.Log.WithValues("handler", "topology")
+		ctx := context.WithValue(r.Context(), loggerCtxKey, logger)
+
+		topology, err := e.topology(ctx, r.URL.Query().Get("namespace"))
+		if err != nil {
+			logger.Error(err, "unable to compute Application topology")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(topology); err != nil {
+			logger.Error(err, "unable to write Application topology")
+		}
+	})
+}
@@ -0,0 +1,326 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: topology.proto
+
+package monitoring
+
+import (
+	context "context"
+	fmt "fmt"
+	proto "github.com/golang/protobuf/proto"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	math "math"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
+
+type StreamApplicationsRequest struct {
+	// Namespace restricts the snapshots to one namespace; empty means all.
+	Namespace string `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	// IntervalSeconds overrides the exporter's default stream interval.
+	IntervalSeconds      int32    `protobuf:"varint,2,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *StreamApplicationsRequest) Reset()         { *m = StreamApplicationsRequest{} }
+func (m *StreamApplicationsRequest) String() string { return proto.CompactTextString(m) }
+func (*StreamApplicationsRequest) ProtoMessage()    {}
+func (*StreamApplicationsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a326f5bb56fea2fc, []int{0}
+}
+
+func (m *StreamApplicationsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_StreamApplicationsRequest.Unmarshal(m, b)
+}
+func (m *StreamApplicationsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_StreamApplicationsRequest.Marshal(b, m, deterministic)
+}
+func (m *StreamApplicationsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_StreamApplicationsRequest.Merge(m, src)
+}
+func (m *StreamApplicationsRequest) XXX_Size() int {
+	return xxx_messageInfo_StreamApplicationsRequest.Size(m)
+}
+func (m *StreamApplicationsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_StreamApplicationsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_StreamApplicationsRequest proto.InternalMessageInfo
+
+func (m *StreamApplicationsRequest) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *StreamApplicationsRequest) GetIntervalSeconds() int32 {
+	if m != nil {
+		return m.IntervalSeconds
+	}
+	return 0
+}
+
+type TopologySnapshot struct {
+	// Unix time at which the snapshot was taken.
+	Timestamp            int64              `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Applications         []*ApplicationPods `protobuf:"bytes,2,rep,name=applications,proto3" json:"applications,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *TopologySnapshot) Reset()         { *m = TopologySnapshot{} }
+func (m *TopologySnapshot) String() string { return proto.CompactTextString(m) }
+func (*TopologySnapshot) ProtoMessage()    {}
+func (*TopologySnapshot) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a326f5bb56fea2fc, []int{1}
+}
+
+func (m *TopologySnapshot) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_TopologySnapshot.Unmarshal(m, b)
+}
+func (m *TopologySnapshot) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_TopologySnapshot.Marshal(b, m, deterministic)
+}
+func (m *TopologySnapshot) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_TopologySnapshot.Merge(m, src)
+}
+func (m *TopologySnapshot) XXX_Size() int {
+	return xxx_messageInfo_TopologySnapshot.Size(m)
+}
+func (m *TopologySnapshot) XXX_DiscardUnknown() {
+	xxx_messageInfo_TopologySnapshot.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_TopologySnapshot proto.InternalMessageInfo
+
+func (m *TopologySnapshot) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *TopologySnapshot) GetApplications() []*ApplicationPods {
+	if m != nil {
+		return m.Applications
+	}
+	return nil
+}
+
+type ApplicationPods struct {
+	Namespace string `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Name      string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	// Descriptor version of the Application.
+	Version              string   `protobuf:"bytes,3,opt,name=version,proto3" json:"version,omitempty"`
+	Pods                 []string `protobuf:"bytes,4,rep,name=pods,proto3" json:"pods,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ApplicationPods) Reset()         { *m = ApplicationPods{} }
+func (m *ApplicationPods) String() string { return proto.CompactTextString(m) }
+func (*ApplicationPods) ProtoMessage()    {}
+func (*ApplicationPods) Descriptor() ([]byte, []int) {
+	return fileDescriptor_a326f5bb56fea2fc, []int{2}
+}
+
+func (m *ApplicationPods) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ApplicationPods.Unmarshal(m, b)
+}
+func (m *ApplicationPods) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ApplicationPods.Marshal(b, m, deterministic)
+}
+func (m *ApplicationPods) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ApplicationPods.Merge(m, src)
+}
+func (m *ApplicationPods) XXX_Size() int {
+	return xxx_messageInfo_ApplicationPods.Size(m)
+}
+func (m *ApplicationPods) XXX_DiscardUnknown() {
+	xxx_messageInfo_ApplicationPods.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ApplicationPods proto.InternalMessageInfo
+
+func (m *ApplicationPods) GetNamespace() string {
+	if m != nil {
+		return m.Namespace
+	}
+	return ""
+}
+
+func (m *ApplicationPods) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *ApplicationPods) GetVersion() string {
+	if m != nil {
+		return m.Version
+	}
+	return ""
+}
+
+func (m *ApplicationPods) GetPods() []string {
+	if m != nil {
+		return m.Pods
+	}
+	return nil
+}
+
+func init() {
+	proto.RegisterType((*StreamApplicationsRequest)(nil), "monitoring.StreamApplicationsRequest")
+	proto.RegisterType((*TopologySnapshot)(nil), "monitoring.TopologySnapshot")
+	proto.RegisterType((*ApplicationPods)(nil), "monitoring.ApplicationPods")
+}
+
+func init() { proto.RegisterFile("topology.proto", fileDescriptor_a326f5bb56fea2fc) }
+
+var fileDescriptor_a326f5bb56fea2fc = []byte{
+	// 271 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x91, 0xd1, 0x4a, 0xf4, 0x30,
+	0x10, 0x85, 0xff, 0x6e, 0xf7, 0x57, 0x3b, 0x2e, 0xee, 0x92, 0xab, 0xa8, 0x7b, 0x51, 0x0a, 0x42,
+	0xbd, 0x29, 0xb2, 0x3e, 0x80, 0xe8, 0x13, 0x48, 0xea, 0x95, 0x20, 0x12, 0xdb, 0xb0, 0x06, 0xda,
+	0x4c, 0xda, 0x89, 0x0b, 0xbe, 0xbd, 0x34, 0x5a, 0x1a, 0x57, 0xc4, 0xbb, 0xcc, 0xe1, 0x64, 0xf8,
+	0xce, 0x19, 0x38, 0x71, 0x68, 0xb1, 0xc1, 0xed, 0x7b, 0x61, 0x7b, 0x74, 0xc8, 0xa0, 0x45, 0xa3,
+	0x1d, 0xf6, 0xda, 0x6c, 0xb3, 0x1a, 0x4e, 0x4b, 0xd7, 0x2b, 0xd9, 0xde, 0x5a, 0xdb, 0xe8, 0x4a,
+	0x3a, 0x8d, 0x86, 0x84, 0xea, 0xde, 0x14, 0x39, 0xb6, 0x86, 0xc4, 0xc8, 0x56, 0x91, 0x95, 0x95,
+	0xe2, 0x51, 0x1a, 0xe5, 0x89, 0x98, 0x04, 0x76, 0x09, 0x2b, 0x6d, 0x9c, 0xea, 0x77, 0xb2, 0x79,
+	0x26, 0x55, 0xa1, 0xa9, 0x89, 0xcf, 0xd2, 0x28, 0xff, 0x2f, 0x96, 0xa3, 0x5e, 0x7e, 0xca, 0x59,
+	0x07, 0xab, 0x87, 0x2f, 0x86, 0xd2, 0x48, 0x4b, 0xaf, 0xe8, 0x97, 0x3b, 0xdd, 0x2a, 0x72, 0xb2,
+	0xb5, 0x7e, 0x79, 0x2c, 0x26, 0x81, 0xdd, 0xc0, 0x42, 0x06, 0x44, 0x7c, 0x96, 0xc6, 0xf9, 0xf1,
+	0xe6, 0xbc, 0x98, 0xd0, 0x8b, 0x80, 0xf8, 0x1e, 0x6b, 0x12, 0xdf, 0x3e, 0x64, 0x1d, 0x2c, 0xf7,
+	0x0c, 0x7f, 0xc4, 0x61, 0x30, 0x1f, 0x06, 0x1f, 0x21, 0x11, 0xfe, 0xcd, 0x38, 0x1c, 0xee, 0x54,
+	0x4f, 0x1a, 0x0d, 0x8f, 0xbd, 0x3c, 0x8e, 0x83, 0xdb, 0x62, 0x4d, 0x7c, 0x9e, 0xc6, 0x83, 0x7b,
+	0x78, 0x6f, 0x34, 0x1c, 0x8d, 0x29, 0xd9, 0x13, 0xb0, 0x9f, 0xbd, 0xb2, 0x8b, 0x90, 0xff, 0xd7,
+	0xde, 0xcf, 0xd6, 0xa1, 0x6d, 0xbf, 0xb8, 0xec, 0xdf, 0x55, 0x74, 0xb7, 0x78, 0x0c, 0x8e, 0xf8,
+	0x72, 0xe0, 0xef, 0x7a, 0xfd, 0x31, 0x00, 0xe9, 0x94, 0x77, 0x33, 0xe9, 0x01, 0x00, 0x00,
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// TopologyClient is the client API for Topology service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type TopologyClient interface {
+	// StreamApplications sends a snapshot immediately and then once per
+	// interval until the client goes away.
+	StreamApplications(ctx context.Context, in *StreamApplicationsRequest, opts ...grpc.CallOption) (Topology_StreamApplicationsClient, error)
+}
+
+type topologyClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewTopologyClient(cc *grpc.ClientConn) TopologyClient {
+	return &topologyClient{cc}
+}
+
+func (c *topologyClient) StreamApplications(ctx context.Context, in *StreamApplicationsRequest, opts ...grpc.CallOption) (Topology_StreamApplicationsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_Topology_serviceDesc.Streams[0], "/monitoring.Topology/StreamApplications", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &topologyStreamApplicationsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Topology_StreamApplicationsClient interface {
+	Recv() (*TopologySnapshot, error)
+	grpc.ClientStream
+}
+
+type topologyStreamApplicationsClient struct {
+	grpc.ClientStream
+}
+
+func (x *topologyStreamApplicationsClient) Recv() (*TopologySnapshot, error) {
+	m := new(TopologySnapshot)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// TopologyServer is the server API for Topology service.
+type TopologyServer interface {
+	// StreamApplications sends a snapshot immediately and then once per
+	// interval until the client goes away.
+	StreamApplications(*StreamApplicationsRequest, Topology_StreamApplicationsServer) error
+}
+
+// UnimplementedTopologyServer can be embedded to have forward compatible implementations.
+type UnimplementedTopologyServer struct {
+}
+
+func (*UnimplementedTopologyServer) StreamApplications(req *StreamApplicationsRequest, srv Topology_StreamApplicationsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamApplications not implemented")
+}
+
+func RegisterTopologyServer(s *grpc.Server, srv TopologyServer) {
+	s.RegisterService(&_Topology_serviceDesc, srv)
+}
+
+func _Topology_StreamApplications_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamApplicationsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TopologyServer).StreamApplications(m, &topologyStreamApplicationsServer{stream})
+}
+
+type Topology_StreamApplicationsServer interface {
+	Send(*TopologySnapshot) error
+	grpc.ServerStream
+}
+
+type topologyStreamApplicationsServer struct {
+	grpc.ServerStream
+}
+
+func (x *topologyStreamApplicationsServer) Send(m *TopologySnapshot) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+var _Topology_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "monitoring.Topology",
+	HandlerType: (*TopologyServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamApplications",
+			Handler:       _Topology_StreamApplications_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "topology.proto",
+}
@@ -0,0 +1,66 @@
+package monitoring
+
+//go:generate protoc --go_out=plugins=grpc:. topology.proto
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RegisterGRPC registers the Topology service, which streams Application to
+// pod topology snapshots, on s.
+func (e *Exporter) RegisterGRPC(s *grpc.Server) {
+	RegisterTopologyServer(s, &topologyServer{exporter: e})
+}
+
+type topologyServer struct {
+	exporter *Exporter
+}
+
+func (t *topologyServer) StreamApplications(req *StreamApplicationsRequest, stream Topology_StreamApplicationsServer) error {
+	interval := t.exporter.options.StreamInterval
+	if req.GetIntervalSeconds() > 0 {
+		interval = time.Duration(req.GetIntervalSeconds()) * time.Second
+	}
+	if interval <= 0 {
+		interval = defaultStreamInterval
+	}
+
+	logger := t.exporter.options.Log.WithValues("stream", "topology")
+	ctx := context.WithValue(stream.Context(), loggerCtxKey, logger)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		topology, err := t.exporter.topology(ctx, req.GetNamespace())
+		if err != nil {
+			logger.Error(err, "unable to compute Application topology")
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		if err := stream.Send(topologySnapshot(topology)); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func topologySnapshot(topology []ApplicationTopology) *TopologySnapshot {
+	snapshot := &TopologySnapshot{Timestamp: time.Now().Unix()}
+	for _, app := range topology {
+		snapshot.Applications = append(snapshot.Applications, &ApplicationPods{
+			Namespace: app.Namespace,
+			Name:      app.Name,
+			Version:   app.Version,
+			Pods:      app.Pods,
+		})
+	}
+	return snapshot
+}
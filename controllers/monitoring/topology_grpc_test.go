@@ -0,0 +1,49 @@
+package monitoring
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestStreamApplications(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	app := newApplication("default", "web", web)
+	app.Spec.Descriptor.Version = "1.2.3"
+	e := newTestExporter(g, Options{},
+		app,
+		newApplication("data", "db", map[string]string{"app": "db"}),
+		newPod("default", "web-0", web, "nginx"),
+	)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	e.RegisterGRPC(server)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.Dial()
+	}))
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := NewTopologyClient(conn).StreamApplications(ctx, &StreamApplicationsRequest{Namespace: "default"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+
+	snapshot, err := stream.Recv()
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(snapshot.GetTimestamp()).To(gomega.BeNumerically(">", 0))
+	g.Expect(snapshot.GetApplications()).To(gomega.HaveLen(1))
+	g.Expect(snapshot.GetApplications()[0].GetNamespace()).To(gomega.Equal("default"))
+	g.Expect(snapshot.GetApplications()[0].GetName()).To(gomega.Equal("web"))
+	g.Expect(snapshot.GetApplications()[0].GetVersion()).To(gomega.Equal("1.2.3"))
+	g.Expect(snapshot.GetApplications()[0].GetPods()).To(gomega.Equal([]string{"web-0"}))
+}
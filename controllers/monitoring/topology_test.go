@@ -0,0 +1,81 @@
+package monitoring
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/onsi/gomega"
+)
+
+func TestTopologyHandler(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	db := map[string]string{"app": "db"}
+	app := newApplication("default", "web", web)
+	app.Spec.Descriptor.Version = "1.2.3"
+	e := newTestExporter(g, Options{},
+		app,
+		newApplication("data", "db", db),
+		newPod("default", "web-1", web, "nginx"),
+		newPod("default", "web-0", web, "nginx"),
+		newPod("data", "db-0", db, "mysql"),
+	)
+	server := httptest.NewServer(e.TopologyHandler())
+	defer server.Close()
+
+	get := func(query string) []ApplicationTopology {
+		resp, err := http.Get(server.URL + query)
+		g.Expect(err).NotTo(gomega.HaveOccurred())
+		defer resp.Body.Close()
+		g.Expect(resp.StatusCode).To(gomega.Equal(http.StatusOK))
+		g.Expect(resp.Header.Get("Content-Type")).To(gomega.Equal("application/json"))
+
+		var topology []ApplicationTopology
+		g.Expect(json.NewDecoder(resp.Body).Decode(&topology)).To(gomega.Succeed())
+		return topology
+	}
+
+	g.Expect(get("")).To(gomega.Equal([]ApplicationTopology{
+		{Namespace: "data", Name: "db", Pods: []string{"db-0"}},
+		{Namespace: "default", Name: "web", Version: "1.2.3", Pods: []string{"web-0", "web-1"}},
+	}))
+	g.Expect(get("?namespace=default")).To(gomega.Equal([]ApplicationTopology{
+		{Namespace: "default", Name: "web", Version: "1.2.3", Pods: []string{"web-0", "web-1"}},
+	}))
+}
+
+func TestTopologyDOT(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", web),
+		newPod("default", "web-0", web, "nginx"),
+		ownedPod("default", "web-1", web, "web", "5d4f"),
+	)
+
+	dot, err := e.TopologyDOT(context.Background(), "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(dot).To(gomega.HavePrefix("digraph topology {\n"))
+	g.Expect(dot).To(gomega.ContainSubstring(`"Application/default/web" -> "Pod/default/web-0";`))
+	g.Expect(dot).To(gomega.ContainSubstring(`"Application/default/web" -> "Deployment/default/web";`))
+	g.Expect(dot).To(gomega.ContainSubstring(`"Deployment/default/web" -> "Pod/default/web-1";`))
+}
+
+func TestTopologyWithoutSelector(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	web := map[string]string{"app": "web"}
+	app := newApplication("default", "web", web)
+	app.Spec.Selector = nil
+	e := newTestExporter(g, Options{}, app, newPod("default", "web-0", web, "nginx"))
+
+	topology, err := e.topology(context.Background(), "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(topology).To(gomega.Equal([]ApplicationTopology{{Namespace: "default", Name: "web", Pods: []string{}}}))
+
+	dot, err := e.TopologyDOT(context.Background(), "")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(dot).NotTo(gomega.ContainSubstring("Pod/default/web-0"))
+}
@@ -0,0 +1,55 @@
+package monitoring
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ServeUnix serves the exporter's metrics on /metrics over a Unix domain
+// socket at socketPath, e.g. for a sidecar scraping locally. A stale socket
+// left behind by a previous run is removed first; any other file, or a socket
+// still accepting connections, is an error. It blocks until the listener
+// fails.
+func (e *Exporter) ServeUnix(socketPath string) error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(e); err != nil {
+		return err
+	}
+
+	if err := removeStaleSocket(socketPath); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	return http.Serve(listener, mux)
+}
+
+// removeStaleSocket removes the socket at socketPath if nothing listens on it.
+func removeStaleSocket(socketPath string) error {
+	info, err := os.Lstat(socketPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", socketPath)
+	}
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s is in use", socketPath)
+	}
+	return os.Remove(socketPath)
+}
@@ -0,0 +1,75 @@
+package monitoring
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+)
+
+func TestServeUnix(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "exporter")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	// A stale socket must not prevent the exporter from starting.
+	socketPath := filepath.Join(dir, "metrics.sock")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: socketPath, Net: "unix"})
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	stale.SetUnlinkOnClose(false)
+	g.Expect(stale.Close()).To(gomega.Succeed())
+
+	lbls := map[string]string{"app": "web"}
+	e := newTestExporter(g, Options{},
+		newApplication("default", "web", lbls),
+		newPod("default", "web-0", lbls, "nginx"),
+	)
+	go func() { _ = e.ServeUnix(socketPath) }()
+
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	var body []byte
+	g.Eventually(func() error {
+		resp, err := httpClient.Get("http://unix/metrics")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, err = ioutil.ReadAll(resp.Body)
+		return err
+	}, 5*time.Second, 50*time.Millisecond).Should(gomega.Succeed())
+	g.Expect(string(body)).To(gomega.ContainSubstring(`kube_pod_owner{container="nginx"`))
+}
+
+func TestServeUnixRefusesOtherFiles(t *testing.T) {
+	g := gomega.NewGomegaWithT(t)
+	dir, err := ioutil.TempDir("", "exporter")
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	defer os.RemoveAll(dir)
+	e := newTestExporter(g, Options{})
+
+	path := filepath.Join(dir, "metrics.sock")
+	g.Expect(ioutil.WriteFile(path, []byte("data"), 0600)).To(gomega.Succeed())
+	g.Expect(e.ServeUnix(path)).To(gomega.MatchError(gomega.ContainSubstring("not a socket")))
+	data, err := ioutil.ReadFile(path)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	g.Expect(string(data)).To(gomega.Equal("data"))
+
+	// A socket still being listened on belongs to a live process.
+	live := filepath.Join(dir, "live.sock")
+	listener, err := net.Listen("unix", live)
+	g.Expect(err).NotTo(gomega.HaveOccurred())
+	defer listener.Close()
+	g.Expect(e.ServeUnix(live)).To(gomega.MatchError(gomega.ContainSubstring("in use")))
+}
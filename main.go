@@ -65,6 +65,7 @@ func main() {
 	exp, err := monitoring.NewAppExporter(monitoring.Options{
 		Log:    ctrl.Log.WithName("controllers").WithName("AppExporter"),
 		Client: mgr.GetClient(),
+		Mapper: mgr.GetRESTMapper(),
 	})
 	metrics.Registry.MustRegister(exp)
 